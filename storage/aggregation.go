@@ -0,0 +1,179 @@
+package esstorage
+
+import (
+	"context"
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	defaultAggregationSize = 10
+
+	termsAggregation = "terms"
+	sumAggregation   = "sum"
+)
+
+// AggregationScope limits the documents of an aggregation, an empty field matches all documents
+type AggregationScope struct {
+	ClusterNames   []string
+	Namespaces     []string
+	GroupResources []schema.GroupResource
+}
+
+func (scope *AggregationScope) newQueryBuilder() *QueryBuilder {
+	builder := NewQueryBuilder()
+	builder.size = 0
+	builder.addExpression(newNotDeletedExpression())
+	if len(scope.ClusterNames) > 0 {
+		builder.addExpression(NewTerms(ClusterPath, scope.ClusterNames))
+	}
+	if len(scope.Namespaces) > 0 {
+		builder.addExpression(NewTerms(NameSpacePath, scope.Namespaces))
+	}
+	if len(scope.GroupResources) > 0 {
+		builder.addExpression(newGroupResourcesExpression(scope.GroupResources))
+	}
+	return builder
+}
+
+// TermsAggregationOptions counts the documents per value of a keyword field,
+// for example `extracted.images` or `extracted.nodeName`
+type TermsAggregationOptions struct {
+	AggregationScope
+
+	Field string
+	// Size is the max number of values returned, ordered by document count
+	Size int
+}
+
+type TermsBucket struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// AggregateTerms returns the top values of the field and the number of documents per value
+func (s *StorageFactory) AggregateTerms(ctx context.Context, opts *TermsAggregationOptions) ([]*TermsBucket, error) {
+	size := opts.Size
+	if size <= 0 {
+		size = defaultAggregationSize
+	}
+
+	builder := opts.newQueryBuilder()
+	builder.addAggregation(termsAggregation, newTermsAggregation(opts.Field, size))
+	r, err := s.index.Search(ctx, builder.build(), s.resourceIndices())
+	if err != nil {
+		return nil, err
+	}
+	agg, err := r.GetTermsAggregation(termsAggregation)
+	if err != nil || agg == nil {
+		return nil, err
+	}
+
+	buckets := make([]*TermsBucket, 0, len(agg.Buckets))
+	for _, bucket := range agg.Buckets {
+		buckets = append(buckets, &TermsBucket{Value: bucket.KeyString(), Count: bucket.DocCount})
+	}
+	return buckets, nil
+}
+
+// SumAggregationOptions adds up a numeric field, for example `extracted.cpuAllocatableMillis`,
+// optionally grouped by the values of a keyword field such as the cluster
+type SumAggregationOptions struct {
+	AggregationScope
+
+	Field   string
+	GroupBy string
+	// Size is the max number of groups returned, ordered by document count
+	Size int
+}
+
+type SumBucket struct {
+	// Group is empty if the sum is not grouped
+	Group string  `json:"group,omitempty"`
+	Count int64   `json:"count"`
+	Sum   float64 `json:"sum"`
+}
+
+type sumAggregationResult struct {
+	Value float64 `json:"value"`
+}
+
+// AggregateSum returns the sum of the field, per group if GroupBy is set
+func (s *StorageFactory) AggregateSum(ctx context.Context, opts *SumAggregationOptions) ([]*SumBucket, error) {
+	sum := map[string]interface{}{
+		"sum": map[string]interface{}{
+			"field": opts.Field,
+		},
+	}
+
+	builder := opts.newQueryBuilder()
+	if opts.GroupBy == "" {
+		builder.addAggregation(sumAggregation, sum)
+		r, err := s.index.Search(ctx, builder.build(), s.resourceIndices())
+		if err != nil {
+			return nil, err
+		}
+		var result sumAggregationResult
+		if raw, ok := r.Aggregations[sumAggregation]; ok {
+			if err := json.Unmarshal(raw, &result); err != nil {
+				return nil, err
+			}
+		}
+		return []*SumBucket{{Count: r.GetTotal(), Sum: result.Value}}, nil
+	}
+
+	size := opts.Size
+	if size <= 0 {
+		size = defaultAggregationSize
+	}
+	terms := newTermsAggregation(opts.GroupBy, size)
+	terms["aggs"] = map[string]interface{}{sumAggregation: sum}
+	builder.addAggregation(termsAggregation, terms)
+	r, err := s.index.Search(ctx, builder.build(), s.resourceIndices())
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := r.Aggregations[termsAggregation]
+	if !ok {
+		return nil, nil
+	}
+	var agg struct {
+		Buckets []struct {
+			Bucket
+			Sum sumAggregationResult `json:"sum"`
+		} `json:"buckets"`
+	}
+	if err := json.Unmarshal(raw, &agg); err != nil {
+		return nil, err
+	}
+	buckets := make([]*SumBucket, 0, len(agg.Buckets))
+	for _, bucket := range agg.Buckets {
+		buckets = append(buckets, &SumBucket{Group: bucket.KeyString(), Count: bucket.DocCount, Sum: bucket.Sum.Value})
+	}
+	return buckets, nil
+}
+
+// newGroupResourcesExpression matches documents belonging to any of the group resources
+func newGroupResourcesExpression(grs []schema.GroupResource) *BoolExpression {
+	groupResources := NewBoolExpression()
+	for _, gr := range grs {
+		bool := NewBoolExpression()
+		bool.SetLogicType(Should)
+		bool.addExpression(NewTerms(GroupPath, []string{gr.Group}))
+		if len(gr.Resource) > 0 {
+			bool.addExpression(NewTerms(ResourcePath, []string{gr.Resource}))
+		}
+		groupResources.addExpression(bool)
+	}
+	return groupResources
+}
+
+func newTermsAggregation(path string, size int) map[string]interface{} {
+	return map[string]interface{}{
+		"terms": map[string]interface{}{
+			"field": path,
+			"size":  size,
+		},
+	}
+}
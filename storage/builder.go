@@ -1,6 +1,8 @@
 package esstorage
 
 import (
+	"time"
+
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/klog/v2"
 )
@@ -30,12 +32,23 @@ func (b *Basic) SetLogicType(t LogicType) {
 	b.logicType = t
 }
 
+const (
+	collapsedTotalAggregation = "collapsed_total"
+	maxCardinalityPrecision   = 40000
+)
+
 type QueryBuilder struct {
-	size    int
-	from    int
-	source  []string
-	sort    []map[string]interface{}
-	boolExp BoolExpression
+	size      int
+	from      int
+	source    []string
+	sort      []map[string]interface{}
+	aggs      map[string]interface{}
+	highlight map[string]interface{}
+	collapse  string
+	// pit and searchAfter page through a point in time, the indices are set by the point in time
+	pit         map[string]interface{}
+	searchAfter []interface{}
+	boolExp     BoolExpression
 }
 
 type SimpleQueryStringExpression struct {
@@ -66,6 +79,17 @@ func (q *QueryBuilder) addExpression(exp Expression) {
 	q.boolExp.addExpression(exp)
 }
 
+func (q *QueryBuilder) addAggregation(name string, agg map[string]interface{}) {
+	if q.aggs == nil {
+		q.aggs = map[string]interface{}{}
+	}
+	q.aggs[name] = agg
+}
+
+func (q *QueryBuilder) setPointInTime(id string, keepAlive string) {
+	q.pit = map[string]interface{}{"id": id, "keep_alive": keepAlive}
+}
+
 func (q *QueryBuilder) build() map[string]interface{} {
 	query := map[string]interface{}{
 		"query": q.boolExp.ToMap(),
@@ -82,6 +106,33 @@ func (q *QueryBuilder) build() map[string]interface{} {
 	if len(q.sort) > 0 {
 		query["sort"] = q.sort
 	}
+	if len(q.aggs) > 0 {
+		query["aggs"] = q.aggs
+	}
+	if len(q.highlight) > 0 {
+		query["highlight"] = q.highlight
+	}
+	if q.collapse != "" {
+		query["collapse"] = map[string]interface{}{"field": q.collapse}
+		// the total hits count the collapsed documents, the collapsed groups are counted by the aggregation
+		aggs := make(map[string]interface{}, len(q.aggs)+1)
+		for name, agg := range q.aggs {
+			aggs[name] = agg
+		}
+		aggs[collapsedTotalAggregation] = map[string]interface{}{
+			"cardinality": map[string]interface{}{
+				"field":               q.collapse,
+				"precision_threshold": maxCardinalityPrecision,
+			},
+		}
+		query["aggs"] = aggs
+	}
+	if q.pit != nil {
+		query["pit"] = q.pit
+	}
+	if len(q.searchAfter) > 0 {
+		query["search_after"] = q.searchAfter
+	}
 	return query
 }
 
@@ -127,6 +178,118 @@ func (t *FuzzyExpression) ToMap() map[string]interface{} {
 	}
 }
 
+type WildcardExpression struct {
+	Basic
+	path  string
+	value string
+}
+
+func NewWildcard(path string, value string) *WildcardExpression {
+	return &WildcardExpression{
+		path:  path,
+		value: value,
+	}
+}
+
+func (t *WildcardExpression) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"wildcard": map[string]interface{}{
+			t.path: map[string]interface{}{
+				"value": t.value,
+			},
+		},
+	}
+}
+
+type MultiMatchExpression struct {
+	Basic
+	query     string
+	fields    []string
+	matchType string
+}
+
+func NewMultiMatch(query string, matchType string, fields ...string) *MultiMatchExpression {
+	return &MultiMatchExpression{
+		query:     query,
+		fields:    fields,
+		matchType: matchType,
+	}
+}
+
+func (t *MultiMatchExpression) ToMap() map[string]interface{} {
+	value := map[string]interface{}{
+		"query":  t.query,
+		"fields": t.fields,
+	}
+	if t.matchType != "" {
+		value["type"] = t.matchType
+	}
+	return map[string]interface{}{
+		"multi_match": value,
+	}
+}
+
+type MoreLikeThisExpression struct {
+	Basic
+	fields []string
+	like   []string
+}
+
+func NewMoreLikeThis(like []string, fields ...string) *MoreLikeThisExpression {
+	return &MoreLikeThisExpression{
+		fields: fields,
+		like:   like,
+	}
+}
+
+func (t *MoreLikeThisExpression) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"more_like_this": map[string]interface{}{
+			"fields":          t.fields,
+			"like":            t.like,
+			"min_term_freq":   1,
+			"min_doc_freq":    1,
+			"max_query_terms": 50,
+		},
+	}
+}
+
+// QueryExpression wraps a query which is already rendered, such as the query of a saved search
+type QueryExpression struct {
+	Basic
+	query map[string]interface{}
+}
+
+func NewQuery(query map[string]interface{}) *QueryExpression {
+	return &QueryExpression{query: query}
+}
+
+func (t *QueryExpression) ToMap() map[string]interface{} {
+	return t.query
+}
+
+type PercolateExpression struct {
+	Basic
+	field    string
+	document map[string]interface{}
+}
+
+func NewPercolate(field string, document map[string]interface{}) *PercolateExpression {
+	return &PercolateExpression{
+		field:    field,
+		document: document,
+	}
+}
+
+func (t *PercolateExpression) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"percolate": map[string]interface{}{
+			"field":    t.field,
+			"document": t.document,
+		},
+	}
+}
+
 type RangeExpression struct {
 	Basic
 	path string
@@ -145,10 +308,71 @@ func NewRange(path string, gte, lte *v1.Time) *RangeExpression {
 func (t *RangeExpression) ToMap() map[string]interface{} {
 	value := map[string]interface{}{}
 	if t.gte != nil {
-		value["gte"] = t.gte.Unix()
+		value["gte"] = t.gte.UTC().Format(time.RFC3339)
 	}
 	if t.lte != nil {
-		value["lte"] = t.lte.Unix()
+		value["lte"] = t.lte.UTC().Format(time.RFC3339)
+	}
+	return map[string]interface{}{
+		"range": map[string]interface{}{
+			t.path: value,
+		},
+	}
+}
+
+// CompareExpression compares the field with the value by the range operator, such as `gt` or `lt`
+type CompareExpression struct {
+	Basic
+	path     string
+	operator string
+	value    interface{}
+}
+
+func NewCompare(path string, operator string, value interface{}) *CompareExpression {
+	return &CompareExpression{
+		path:     path,
+		operator: operator,
+		value:    value,
+	}
+}
+
+func (t *CompareExpression) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"range": map[string]interface{}{
+			t.path: map[string]interface{}{
+				t.operator: t.value,
+			},
+		},
+	}
+}
+
+// dateRangeFormat parses the dates of the range queries regardless of the format of the date fields,
+// the date fields of the indices created before epoch dates were accepted only have the default format
+const dateRangeFormat = "strict_date_optional_time"
+
+// DateRangeExpression accepts dates and date math, for example `2022-01-01T00:00:00Z` or `now-1h`
+type DateRangeExpression struct {
+	Basic
+	path string
+	gte  string
+	lte  string
+}
+
+func NewDateRange(path string, gte, lte string) *DateRangeExpression {
+	return &DateRangeExpression{
+		path: path,
+		gte:  gte,
+		lte:  lte,
+	}
+}
+
+func (t *DateRangeExpression) ToMap() map[string]interface{} {
+	value := map[string]interface{}{"format": dateRangeFormat}
+	if t.gte != "" {
+		value["gte"] = t.gte
+	}
+	if t.lte != "" {
+		value["lte"] = t.lte
 	}
 	return map[string]interface{}{
 		"range": map[string]interface{}{
@@ -157,15 +381,43 @@ func (t *RangeExpression) ToMap() map[string]interface{} {
 	}
 }
 
+type NestedExpression struct {
+	Basic
+	path  string
+	query *BoolExpression
+}
+
+func NewNested(path string, query *BoolExpression) *NestedExpression {
+	return &NestedExpression{
+		path:  path,
+		query: query,
+	}
+}
+
+func (t *NestedExpression) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"nested": map[string]interface{}{
+			"path":  t.path,
+			"query": t.query.ToMap(),
+		},
+	}
+}
+
 type ExistExpression struct {
 	Basic
 	path string
 }
 
+func NewExists(path string) *ExistExpression {
+	return &ExistExpression{
+		path: path,
+	}
+}
+
 func (t *ExistExpression) ToMap() map[string]interface{} {
 	return map[string]interface{}{
-		"exist": map[string]interface{}{
-			t.path: "",
+		"exists": map[string]interface{}{
+			"field": t.path,
 		},
 	}
 }
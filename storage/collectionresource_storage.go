@@ -55,7 +55,7 @@ func (s *CollectionResourceStorage) Get(ctx context.Context, opts *internal.List
 			ObjectMetaPath,
 		}
 	}
-	err := applyListOptionToQueryBuilder(builder, opts)
+	err := applyListOptionToQueryBuilder(ctx, &savedSearchExpander{index: s.index}, builder, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -69,7 +69,8 @@ func (s *CollectionResourceStorage) Get(ctx context.Context, opts *internal.List
 		TypeMeta:   s.collectionResource.TypeMeta,
 		ObjectMeta: s.collectionResource.ObjectMeta,
 	}
-	for _, item := range r.GetResources() {
+	highlights := r.GetHighlights(FullTextObjectPath)
+	for i, item := range r.GetResources() {
 		object := item.Object
 
 		byte, err := json.Marshal(object)
@@ -80,6 +81,9 @@ func (s *CollectionResourceStorage) Get(ctx context.Context, opts *internal.List
 		if err != nil {
 			return nil, err
 		}
+		if err := setHighlightAnnotation(unObj, highlights[i]); err != nil {
+			return nil, err
+		}
 		objects = append(objects, unObj)
 
 		gvrs := make(map[schema.GroupVersionResource]struct{})
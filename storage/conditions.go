@@ -0,0 +1,76 @@
+package esstorage
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// URLQueryConditionType, URLQueryConditionStatus and URLQueryConditionReason match resources
+	// that have a status condition with all the given values,
+	// URLQueryConditionAge requires the condition to be in its status for at least the duration, for example `10m`
+	URLQueryConditionType   = "conditionType"
+	URLQueryConditionStatus = "conditionStatus"
+	URLQueryConditionReason = "conditionReason"
+	URLQueryConditionAge    = "conditionAge"
+)
+
+var conditionFields = []string{"type", "status", "reason", "lastTransitionTime"}
+
+// extractConditions returns the status conditions of the object, which follow the conditions convention
+func extractConditions(object map[string]interface{}) []map[string]interface{} {
+	items, ok := simpleMapExtract("status.conditions", object).([]interface{})
+	if !ok {
+		return nil
+	}
+	var conditions []map[string]interface{}
+	for _, item := range items {
+		condition, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		result := make(map[string]interface{}, len(conditionFields))
+		for _, field := range conditionFields {
+			if value, ok := condition[field].(string); ok && value != "" {
+				result[field] = value
+			}
+		}
+		if _, ok := result["type"]; ok {
+			conditions = append(conditions, result)
+		}
+	}
+	return conditions
+}
+
+// newConditionExpression returns the nested query of the condition options, or nil if no option is set
+func newConditionExpression(urlQuery url.Values) (*NestedExpression, error) {
+	condition := NewBoolExpression()
+	for _, option := range []struct{ key, field string }{
+		{URLQueryConditionType, "type"},
+		{URLQueryConditionStatus, "status"},
+		{URLQueryConditionReason, "reason"},
+	} {
+		if values := urlQuery[option.key]; len(values) > 0 {
+			condition.addExpression(NewTerms(strings.Join([]string{ConditionsPath, option.field}, "."), values))
+		}
+	}
+
+	if urlQuery.Has(URLQueryConditionAge) {
+		age, err := time.ParseDuration(urlQuery.Get(URLQueryConditionAge))
+		if err != nil {
+			return nil, fmt.Errorf("%s query: %w", URLQueryConditionAge, err)
+		}
+		if age < 0 {
+			return nil, fmt.Errorf("%s query: %q must not be negative", URLQueryConditionAge, urlQuery.Get(URLQueryConditionAge))
+		}
+		lte := fmt.Sprintf("now-%ds", int64(age.Seconds()))
+		condition.addExpression(NewDateRange(ConditionsPath+".lastTransitionTime", "", lte))
+	}
+
+	if len(condition.expressions) == 0 {
+		return nil, nil
+	}
+	return NewNested(ConditionsPath, condition), nil
+}
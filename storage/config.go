@@ -1,7 +1,53 @@
 package esstorage
 
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
 type Config struct {
 	Addresses []string `env:"ES_ADDRESSES"`
 	UserName  string   `env:"ES_USER"`
 	Password  string   `env:"ES_PASSWORD"`
+
+	FullTextSearch FullTextSearchConfig   `yaml:"fullTextSearch"`
+	DataProtection []DataProtectionConfig `yaml:"dataProtection"`
+	Redaction      []RedactionRule        `yaml:"redaction"`
+	Pruning        []PruningRule          `yaml:"pruning"`
+	Extraction     []ExtractionRule       `yaml:"extraction"`
+	Mappings       []MappingOverride      `yaml:"mappings"`
+	Fingerprint    []FingerprintRule      `yaml:"fingerprint"`
+	History        HistoryConfig          `yaml:"history"`
+	Tombstones     TombstonesConfig       `yaml:"tombstones"`
+	Percolator     PercolatorConfig       `yaml:"percolator"`
+	Events         EventsConfig           `yaml:"events"`
+	Metrics        MetricsConfig          `yaml:"metrics"`
+}
+
+// FullTextSearchConfig overrides the AllowObjectFullTextSearch feature gate per resource,
+// resources are written as `resource.group`, for example `deployments.apps` or `pods`
+type FullTextSearchConfig struct {
+	IncludeResources []string `yaml:"includeResources"`
+	ExcludeResources []string `yaml:"excludeResources"`
+}
+
+// Enabled reports whether the objects of the group resource are indexed for full text search,
+// the feature gate decides for resources that are neither included nor excluded
+func (c *FullTextSearchConfig) Enabled(gr schema.GroupResource, featureEnabled bool) bool {
+	switch {
+	case groupResourceSet(c.ExcludeResources).Has(gr.String()):
+		return false
+	case groupResourceSet(c.IncludeResources).Has(gr.String()):
+		return true
+	default:
+		return featureEnabled
+	}
+}
+
+func groupResourceSet(resources []string) sets.String {
+	set := sets.NewString()
+	for _, resource := range resources {
+		set.Insert(schema.ParseGroupResource(resource).String())
+	}
+	return set
 }
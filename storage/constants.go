@@ -1,5 +1,9 @@
 package esstorage
 
+const (
+	ClusterAnnotation = "shadow.clusterpedia.io/cluster-name"
+)
+
 const (
 	ObjectPath            = "object"
 	SpecPath              = "spec"
@@ -8,7 +12,12 @@ const (
 	NamePath              = "object.metadata.name"
 	OwnerReferencePath    = "object.metadata.ownerReferences.uid"
 	CreationTimestampPath = "object.metadata.creationTimestamp"
+	DeletionTimestampPath = "object.metadata.deletionTimestamp"
+	LastTimestampPath     = "object.lastTimestamp"
+	EventTimePath         = "object.eventTime"
+	StartTimePath         = "extracted.startTime"
 	LabelPath             = "object.metadata.labels"
+	AnnotationPath        = "object.metadata.annotations"
 	GroupPath             = "group"
 	VersionPath           = "version"
 	ResourcePath          = "resource"
@@ -17,5 +26,12 @@ const (
 	ApiVersionPath        = "object.apiVersion"
 	KindPath              = "object.kind"
 	ObjectMetaPath        = "object.metadata"
+	ExtractedPath         = "extracted"
+	ConditionsPath        = "conditions"
 	FullTextObjectPath    = "custom.fullTextObject"
+	NameSuggestPath       = "name.suggest"
+	NameWildcardPath      = "name.wildcard"
+	NamespaceWildcardPath = "namespace.wildcard"
+	LabelKeysPath         = "custom.labelKeys"
+	AnnotationKeysPath    = "custom.annotationKeys"
 )
@@ -0,0 +1,84 @@
+package esstorage
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// FieldDiff is a field whose value differs between two objects, a nil value means the field is absent
+type FieldDiff struct {
+	Path string      `json:"path"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// diffObjects compares two unstructured objects field by field, maps are compared by key
+// and lists by index, the diffs are ordered by path
+func diffObjects(from, to map[string]interface{}) []FieldDiff {
+	var diffs []FieldDiff
+	diffValues("", from, to, &diffs)
+	return diffs
+}
+
+func diffValues(path string, from, to interface{}, diffs *[]FieldDiff) {
+	switch fromValue := from.(type) {
+	case map[string]interface{}:
+		toValue, ok := to.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make(map[string]struct{}, len(fromValue)+len(toValue))
+		for key := range fromValue {
+			keys[key] = struct{}{}
+		}
+		for key := range toValue {
+			keys[key] = struct{}{}
+		}
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+		for _, key := range sorted {
+			diffValues(joinFieldPath(path, key), fromValue[key], toValue[key], diffs)
+		}
+		return
+	case []interface{}:
+		toValue, ok := to.([]interface{})
+		if !ok {
+			break
+		}
+		length := len(fromValue)
+		if len(toValue) > length {
+			length = len(toValue)
+		}
+		for i := 0; i < length; i++ {
+			var fromItem, toItem interface{}
+			if i < len(fromValue) {
+				fromItem = fromValue[i]
+			}
+			if i < len(toValue) {
+				toItem = toValue[i]
+			}
+			diffValues(fmt.Sprintf("%s[%d]", path, i), fromItem, toItem, diffs)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		*diffs = append(*diffs, FieldDiff{Path: path, From: from, To: to})
+	}
+}
+
+// joinFieldPath writes the key in the field path syntax, keys with dots are quoted
+func joinFieldPath(path, key string) string {
+	if strings.ContainsAny(key, ".[]") {
+		return fmt.Sprintf("%s['%s']", path, key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,30 @@
+package esstorage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffObjects(t *testing.T) {
+	from := map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": map[string]interface{}{"app.kubernetes.io/name": "a"}},
+		"spec":     map[string]interface{}{"replicas": int64(1), "paused": true, "args": []interface{}{"a", "b"}},
+	}
+	to := map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": map[string]interface{}{"app.kubernetes.io/name": "b"}},
+		"spec":     map[string]interface{}{"replicas": int64(3), "minReadySeconds": int64(5), "args": []interface{}{"a", "c"}},
+	}
+	want := []FieldDiff{
+		{Path: "metadata.labels['app.kubernetes.io/name']", From: "a", To: "b"},
+		{Path: "spec.args[1]", From: "b", To: "c"},
+		{Path: "spec.minReadySeconds", To: int64(5)},
+		{Path: "spec.paused", From: true},
+		{Path: "spec.replicas", From: int64(1), To: int64(3)},
+	}
+	if got := diffObjects(from, to); !reflect.DeepEqual(got, want) {
+		t.Errorf("diffObjects() = %+v, want %+v", got, want)
+	}
+	if got := diffObjects(to, to); got != nil {
+		t.Errorf("diffObjects() of equal objects = %+v", got)
+	}
+}
@@ -1,6 +1,13 @@
 package esstorage
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
 
 // ESError is an error type which represents a single ES error
 type ESError struct {
@@ -11,3 +18,58 @@ type ESError struct {
 func (e *ESError) Error() string {
 	return fmt.Sprintf("Error %d: %s", e.StatusCode, e.Message)
 }
+
+// MappingError is returned when Elasticsearch rejects a document because of its mapping,
+// such as a field type conflict or exceeding the total fields limit
+type MappingError struct {
+	Index  string
+	Type   string
+	Reason string
+}
+
+func (e *MappingError) Error() string {
+	return fmt.Sprintf("index %s rejected the document by mapping, %s: %s", e.Index, e.Type, e.Reason)
+}
+
+// OwnerLimitError is returned when the owner hierarchy has more objects than can be used to filter the resources
+type OwnerLimitError struct {
+	Cluster string
+	Limit   int
+}
+
+func (e *OwnerLimitError) Error() string {
+	return fmt.Sprintf("the owner hierarchy in cluster %s has more than %d objects, narrow the owner or its seniority", e.Cluster, e.Limit)
+}
+
+var mappingErrorTypes = sets.NewString(
+	"mapper_parsing_exception",
+	"document_parsing_exception",
+	"strict_dynamic_mapping_exception",
+	"illegal_argument_exception",
+)
+
+// asMappingError converts the ES error to a MappingError if the document is rejected by mapping
+func asMappingError(err error, index string) (*MappingError, bool) {
+	esError, ok := err.(*ESError)
+	if !ok || esError.StatusCode != http.StatusBadRequest {
+		return nil, false
+	}
+
+	var body struct {
+		Error struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	}
+	message := esError.Message
+	if i := strings.Index(message, "{"); i != -1 {
+		message = message[i:]
+	}
+	if err := json.Unmarshal([]byte(message), &body); err != nil || !mappingErrorTypes.Has(body.Error.Type) {
+		return nil, false
+	}
+	if body.Error.Type == "illegal_argument_exception" && !strings.Contains(body.Error.Reason, "Limit of") {
+		return nil, false
+	}
+	return &MappingError{Index: index, Type: body.Error.Type, Reason: body.Error.Reason}, true
+}
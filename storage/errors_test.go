@@ -0,0 +1,25 @@
+package esstorage
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestAsMappingError(t *testing.T) {
+	err := &ESError{StatusCode: http.StatusBadRequest, Message: `[400 Bad Request] {"error":{"type":"mapper_parsing_exception",` +
+		`"reason":"failed to parse field [object.spec.replicas] of type [long]"},"status":400}`}
+	want := &MappingError{Index: "pods", Type: "mapper_parsing_exception", Reason: "failed to parse field [object.spec.replicas] of type [long]"}
+	if got, ok := asMappingError(err, "pods"); !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("asMappingError() = %+v, %v, want %+v", got, ok, want)
+	}
+
+	for _, err := range []*ESError{
+		{StatusCode: http.StatusBadRequest, Message: `{"error":{"type":"illegal_argument_exception","reason":"unknown setting"}}`},
+		{StatusCode: http.StatusConflict, Message: `{"error":{"type":"mapper_parsing_exception","reason":"conflict"}}`},
+	} {
+		if _, ok := asMappingError(err, "pods"); ok {
+			t.Errorf("asMappingError(%s) should not be a mapping error", err.Message)
+		}
+	}
+}
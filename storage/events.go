@@ -0,0 +1,240 @@
+package esstorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	internal "github.com/clusterpedia-io/api/clusterpedia"
+)
+
+const (
+	TimestampPath         = "@timestamp"
+	InvolvedObjectUIDPath = "object.involvedObject.uid"
+
+	// maxOwnerTreeDepth limits the levels of the descendants whose events are listed with the owner,
+	// for example a CronJob owns Jobs which own Pods
+	maxOwnerTreeDepth = 5
+
+	eventsLifecyclePolicy = "clusterpedia-events"
+	eventsIndexTemplate   = "clusterpedia-events"
+
+	defaultEventsRetention       = "30d"
+	defaultEventsRolloverMaxAge  = "1d"
+	defaultEventsRolloverMaxSize = "50gb"
+)
+
+const (
+	// URLQueryInvolvedObjectKind, URLQueryInvolvedObjectNamespace, URLQueryInvolvedObjectName,
+	// URLQueryInvolvedObjectUID, URLQueryEventReason, URLQueryEventType and URLQueryEventSource
+	// filter the events, they can be combined with the `lastTimestampSince` and `lastTimestampBefore` queries
+	URLQueryInvolvedObjectKind      = "involvedObjectKind"
+	URLQueryInvolvedObjectNamespace = "involvedObjectNamespace"
+	URLQueryInvolvedObjectName      = "involvedObjectName"
+	URLQueryInvolvedObjectUID       = "involvedObjectUID"
+	URLQueryEventReason             = "eventReason"
+	URLQueryEventType               = "eventType"
+	URLQueryEventSource             = "eventSource"
+)
+
+var eventFilters = []struct {
+	key   string
+	paths []string
+}{
+	{URLQueryInvolvedObjectKind, []string{"object.involvedObject.kind"}},
+	{URLQueryInvolvedObjectNamespace, []string{"object.involvedObject.namespace"}},
+	{URLQueryInvolvedObjectName, []string{"object.involvedObject.name"}},
+	{URLQueryInvolvedObjectUID, []string{InvolvedObjectUIDPath}},
+	{URLQueryEventReason, []string{"object.reason"}},
+	{URLQueryEventType, []string{"object.type"}},
+	{URLQueryEventSource, []string{"object.source.component", "object.reportingComponent"}},
+}
+
+// EventsConfig configures the storage of the core events
+type EventsConfig struct {
+	// DataStream writes the events to a data stream whose backing indices roll over and
+	// are deleted by an ILM policy, every revision of an event is appended to the data stream.
+	// the existing events index must be removed before enabling it
+	DataStream bool `yaml:"dataStream"`
+
+	// Retention is the min age of the deleted backing indices, it defaults to 30d
+	Retention string `yaml:"retention"`
+	// RolloverMaxAge and RolloverMaxPrimaryShardSize default to 1d and 50gb
+	RolloverMaxAge              string `yaml:"rolloverMaxAge"`
+	RolloverMaxPrimaryShardSize string `yaml:"rolloverMaxPrimaryShardSize"`
+}
+
+func isEventResource(gr schema.GroupResource) bool {
+	return gr == schema.GroupResource{Resource: ResourceEvent}
+}
+
+// ensureEventDataStream installs the ILM policy and the index template of the events data stream,
+// the data stream itself is created by the first write
+func ensureEventDataStream(ctx context.Context, index *Index, config *EventsConfig, name string, mapping string) error {
+	isDataStream, err := index.IsDataStream(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !isDataStream {
+		exists, err := index.Exists(ctx, name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("index %s exists, it must be removed before storing events in a data stream", name)
+		}
+	}
+
+	retention, maxAge, maxSize := config.Retention, config.RolloverMaxAge, config.RolloverMaxPrimaryShardSize
+	if retention == "" {
+		retention = defaultEventsRetention
+	}
+	if maxAge == "" {
+		maxAge = defaultEventsRolloverMaxAge
+	}
+	if maxSize == "" {
+		maxSize = defaultEventsRolloverMaxSize
+	}
+	policy := map[string]interface{}{
+		"phases": map[string]interface{}{
+			"hot": map[string]interface{}{
+				"actions": map[string]interface{}{
+					"rollover": map[string]interface{}{
+						"max_age":                maxAge,
+						"max_primary_shard_size": maxSize,
+					},
+				},
+			},
+			"delete": map[string]interface{}{
+				"min_age": retention,
+				"actions": map[string]interface{}{
+					"delete": map[string]interface{}{},
+				},
+			},
+		},
+	}
+	if err := index.PutLifecyclePolicy(ctx, eventsLifecyclePolicy, policy); err != nil {
+		return err
+	}
+
+	// the template reuses the settings and mappings of the events index, but not the resource alias,
+	// because an alias cannot point to both indices and data streams, the searches of the alias
+	// add the data stream by resourceIndices instead
+	var template map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte(mapping), &template); err != nil {
+		return err
+	}
+	settings, mappings := template["settings"], template["mappings"]
+	settings["index.lifecycle.name"] = eventsLifecyclePolicy
+	properties, _ := mappings["properties"].(map[string]interface{})
+	properties[TimestampPath] = map[string]interface{}{"type": "date"}
+
+	return index.PutIndexTemplate(ctx, eventsIndexTemplate, map[string]interface{}{
+		"index_patterns": []string{name},
+		"data_stream":    map[string]interface{}{},
+		"priority":       200,
+		"template": map[string]interface{}{
+			"settings": settings,
+			"mappings": mappings,
+		},
+	})
+}
+
+// resourceIndices returns the alias of the resource indices and the events data stream if it is enabled
+func (s *StorageFactory) resourceIndices() []string {
+	if s.config.Events.DataStream {
+		return []string{s.indexAlias, generateIndexName("", ResourceEvent)}
+	}
+	return []string{s.indexAlias}
+}
+
+// deleteEventRevisions deletes all the revisions of the event from the data stream,
+// the documents of a data stream cannot be updated to mark them deleted
+func (s *ResourceStorage) deleteEventRevisions(ctx context.Context, uid string) error {
+	builder := NewQueryBuilder()
+	builder.addExpression(NewTerms(UIDPath, []string{uid}))
+	return s.index.DeleteByQuery(ctx, builder.build(), s.indexName)
+}
+
+// eventTimestamp returns the time of the latest occurrence of the event
+func eventTimestamp(object map[string]interface{}) string {
+	for _, path := range []string{"lastTimestamp", "eventTime", "series.lastObservedTime", "firstTimestamp", "metadata.creationTimestamp"} {
+		if value, ok := simpleMapExtract(path, object).(string); ok && value != "" {
+			return value
+		}
+	}
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// createEventRevision appends the event to the data stream, the document id is unique per revision
+func (s *ResourceStorage) createEventRevision(ctx context.Context, uid, resourceVersion string, doc map[string]interface{}) error {
+	doc[TimestampPath] = eventTimestamp(doc["object"].(map[string]interface{}))
+	err := s.index.Create(ctx, s.indexName, uid+"-"+resourceVersion, doc)
+	if esError, ok := err.(*ESError); ok && esError.StatusCode == http.StatusConflict {
+		return nil
+	}
+	return err
+}
+
+// getInvolvedObjectUIDs returns the uids of the owner set by `OwnerUID` or `OwnerName` and all its descendants,
+// `OwnerSeniority` is ignored because the events of every level are listed
+func (s *ResourceStorage) getInvolvedObjectUIDs(ctx context.Context, opts *internal.ListOptions) ([]string, error) {
+	cluster := opts.ClusterNames[0]
+	owners := newOwnerNodes([]string{opts.OwnerUID})
+	if opts.OwnerUID == "" {
+		var err error
+		if owners, err = s.getOwnersByName(ctx, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	uids := sets.NewString(ownerUIDs(owners)...)
+	for depth := 0; depth < maxOwnerTreeDepth && len(owners) != 0; depth++ {
+		children, err := s.searchChildren(ctx, cluster, owners, maxOwnerUIDs-uids.Len())
+		if err != nil {
+			return nil, err
+		}
+		owners = owners[:0]
+		for _, child := range children {
+			if !uids.Has(child.uid) {
+				uids.Insert(child.uid)
+				owners = append(owners, child)
+			}
+		}
+	}
+	return uids.List(), nil
+}
+
+// applyEventQuery adds the event filters, and collapses the revisions of the data stream to the latest one
+func (s *ResourceStorage) applyEventQuery(builder *QueryBuilder, urlQuery url.Values) {
+	for _, filter := range eventFilters {
+		values := urlQuery[filter.key]
+		if len(values) == 0 {
+			continue
+		}
+		if len(filter.paths) == 1 {
+			builder.addExpression(NewTerms(filter.paths[0], values))
+			continue
+		}
+		matchAny := NewBoolExpression()
+		for _, path := range filter.paths {
+			queryItem := NewTerms(path, values)
+			queryItem.SetLogicType(Should)
+			matchAny.addExpression(queryItem)
+		}
+		builder.addExpression(matchAny)
+	}
+
+	if s.dataStream {
+		builder.collapse = UIDPath
+		builder.sort = append(builder.sort, map[string]interface{}{
+			TimestampPath: map[string]interface{}{"order": "desc"},
+		})
+	}
+}
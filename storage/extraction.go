@@ -0,0 +1,334 @@
+package esstorage
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+type ExtractedFieldType string
+
+const (
+	ExtractedFieldKeyword ExtractedFieldType = "keyword"
+	ExtractedFieldLong    ExtractedFieldType = "long"
+	ExtractedFieldBoolean ExtractedFieldType = "boolean"
+	ExtractedFieldDate    ExtractedFieldType = "date"
+
+	// ExtractedFieldQuantity stores Kubernetes quantities in base units, for example bytes of memory
+	ExtractedFieldQuantity ExtractedFieldType = "quantity"
+	// ExtractedFieldMilliQuantity stores Kubernetes quantities in thousandths, for example millicores of cpu
+	ExtractedFieldMilliQuantity ExtractedFieldType = "milliQuantity"
+)
+
+// ExtractionRule writes typed fields extracted from the objects of a resource into the document,
+// the fields can be queried as `extracted.<name>` by the field selector and the aggregations
+type ExtractionRule struct {
+	// Resource is written as `resource.group`, for example `pods` or `deployments.apps`,
+	// `*` applies the rule to every resource
+	Resource string           `yaml:"resource"`
+	Fields   []ExtractedField `yaml:"fields"`
+}
+
+type ExtractedField struct {
+	Name string `yaml:"name"`
+	// Paths are JSONPath-like paths, the values of all paths are merged
+	Paths []string `yaml:"paths"`
+	// Type defaults to keyword
+	Type ExtractedFieldType `yaml:"type"`
+	// Sum adds up the numeric values into a single value, for example the requests of all containers
+	Sum bool `yaml:"sum"`
+}
+
+var workloadImagePaths = []string{
+	"spec.template.spec.containers[*].image",
+	"spec.template.spec.initContainers[*].image",
+}
+
+// defaultExtractionRules are overridden by the rules in the config with the same resource and field name
+var defaultExtractionRules = []ExtractionRule{
+	{
+		Resource: anyResource,
+		Fields: []ExtractedField{
+			{Name: "ownerKind", Paths: []string{"metadata.ownerReferences[*].kind"}},
+			{Name: "ownerName", Paths: []string{"metadata.ownerReferences[*].name"}},
+		},
+	},
+	{
+		Resource: "pods",
+		Fields: []ExtractedField{
+			{Name: "images", Paths: []string{"spec.containers[*].image", "spec.initContainers[*].image"}},
+			{Name: "nodeName", Paths: []string{"spec.nodeName"}},
+			{Name: "podPhase", Paths: []string{"status.phase"}},
+			{Name: "startTime", Paths: []string{"status.startTime"}, Type: ExtractedFieldDate},
+			{Name: "cpuRequestMillis", Paths: []string{"spec.containers[*].resources.requests.cpu"}, Type: ExtractedFieldMilliQuantity, Sum: true},
+			{Name: "cpuLimitMillis", Paths: []string{"spec.containers[*].resources.limits.cpu"}, Type: ExtractedFieldMilliQuantity, Sum: true},
+			{Name: "memoryRequestBytes", Paths: []string{"spec.containers[*].resources.requests.memory"}, Type: ExtractedFieldQuantity, Sum: true},
+			{Name: "memoryLimitBytes", Paths: []string{"spec.containers[*].resources.limits.memory"}, Type: ExtractedFieldQuantity, Sum: true},
+		},
+	},
+	{Resource: "deployments.apps", Fields: []ExtractedField{{Name: "images", Paths: workloadImagePaths}}},
+	{Resource: "statefulsets.apps", Fields: []ExtractedField{{Name: "images", Paths: workloadImagePaths}}},
+	{Resource: "daemonsets.apps", Fields: []ExtractedField{{Name: "images", Paths: workloadImagePaths}}},
+	{Resource: "replicasets.apps", Fields: []ExtractedField{{Name: "images", Paths: workloadImagePaths}}},
+	{Resource: "jobs.batch", Fields: []ExtractedField{{Name: "images", Paths: workloadImagePaths}}},
+	{
+		Resource: "cronjobs.batch",
+		Fields: []ExtractedField{
+			{Name: "images", Paths: []string{
+				"spec.jobTemplate.spec.template.spec.containers[*].image",
+				"spec.jobTemplate.spec.template.spec.initContainers[*].image",
+			}},
+		},
+	},
+	{
+		Resource: "nodes",
+		Fields: []ExtractedField{
+			{Name: "cpuCapacityMillis", Paths: []string{"status.capacity.cpu"}, Type: ExtractedFieldMilliQuantity},
+			{Name: "cpuAllocatableMillis", Paths: []string{"status.allocatable.cpu"}, Type: ExtractedFieldMilliQuantity},
+			{Name: "memoryCapacityBytes", Paths: []string{"status.capacity.memory"}, Type: ExtractedFieldQuantity},
+			{Name: "memoryAllocatableBytes", Paths: []string{"status.allocatable.memory"}, Type: ExtractedFieldQuantity},
+			{Name: "podsCapacity", Paths: []string{"status.capacity.pods"}, Type: ExtractedFieldQuantity},
+			{Name: "podsAllocatable", Paths: []string{"status.allocatable.pods"}, Type: ExtractedFieldQuantity},
+		},
+	},
+	{
+		Resource: "resourcequotas",
+		Fields: []ExtractedField{
+			{Name: "hardRequestsCpuMillis", Paths: []string{"status.hard['requests.cpu']", "status.hard.cpu"}, Type: ExtractedFieldMilliQuantity},
+			{Name: "usedRequestsCpuMillis", Paths: []string{"status.used['requests.cpu']", "status.used.cpu"}, Type: ExtractedFieldMilliQuantity},
+			{Name: "hardLimitsCpuMillis", Paths: []string{"status.hard['limits.cpu']"}, Type: ExtractedFieldMilliQuantity},
+			{Name: "usedLimitsCpuMillis", Paths: []string{"status.used['limits.cpu']"}, Type: ExtractedFieldMilliQuantity},
+			{Name: "hardRequestsMemoryBytes", Paths: []string{"status.hard['requests.memory']", "status.hard.memory"}, Type: ExtractedFieldQuantity},
+			{Name: "usedRequestsMemoryBytes", Paths: []string{"status.used['requests.memory']", "status.used.memory"}, Type: ExtractedFieldQuantity},
+			{Name: "hardLimitsMemoryBytes", Paths: []string{"status.hard['limits.memory']"}, Type: ExtractedFieldQuantity},
+			{Name: "usedLimitsMemoryBytes", Paths: []string{"status.used['limits.memory']"}, Type: ExtractedFieldQuantity},
+		},
+	},
+	{
+		Resource: "services",
+		Fields: []ExtractedField{
+			{Name: "serviceType", Paths: []string{"spec.type"}},
+		},
+	},
+	{
+		Resource: "ingresses.networking.k8s.io",
+		Fields: []ExtractedField{
+			{Name: "ingressHosts", Paths: []string{"spec.rules[*].host", "spec.tls[*].hosts[*]"}},
+		},
+	},
+	{
+		Resource: "persistentvolumeclaims",
+		Fields: []ExtractedField{
+			{Name: "storageClass", Paths: []string{"spec.storageClassName"}},
+		},
+	},
+}
+
+type fieldExtractor struct {
+	name      string
+	paths     []fieldPath
+	fieldType ExtractedFieldType
+	sum       bool
+}
+
+type extractors map[string][]*fieldExtractor
+
+func newExtractors(rules []ExtractionRule) (extractors, error) {
+	result := make(extractors)
+	for _, rules := range [][]ExtractionRule{defaultExtractionRules, rules} {
+		for i, rule := range rules {
+			if rule.Resource == "" {
+				return nil, fmt.Errorf("extraction rule %d: resource is required", i)
+			}
+			resource := rule.Resource
+			if resource != anyResource {
+				resource = schema.ParseGroupResource(resource).String()
+			}
+			for _, field := range rule.Fields {
+				extractor, err := newFieldExtractor(field)
+				if err != nil {
+					return nil, fmt.Errorf("extraction rule %d: %w", i, err)
+				}
+				result[resource] = setFieldExtractor(result[resource], extractor)
+			}
+		}
+	}
+	return result, nil
+}
+
+func newFieldExtractor(field ExtractedField) (*fieldExtractor, error) {
+	if field.Name == "" {
+		return nil, fmt.Errorf("field name is required")
+	}
+	if len(field.Paths) == 0 {
+		return nil, fmt.Errorf("field %s: paths is required", field.Name)
+	}
+	extractor := &fieldExtractor{name: field.Name, fieldType: field.Type, sum: field.Sum}
+	switch extractor.fieldType {
+	case "":
+		extractor.fieldType = ExtractedFieldKeyword
+	case ExtractedFieldKeyword, ExtractedFieldLong, ExtractedFieldBoolean, ExtractedFieldDate,
+		ExtractedFieldQuantity, ExtractedFieldMilliQuantity:
+	default:
+		return nil, fmt.Errorf("field %s: unknown type %q", field.Name, field.Type)
+	}
+	if extractor.sum && extractor.esType() != "long" {
+		return nil, fmt.Errorf("field %s: sum requires a numeric type", field.Name)
+	}
+	for _, path := range field.Paths {
+		fieldPath, err := parseFieldPath(path)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		extractor.paths = append(extractor.paths, fieldPath)
+	}
+	return extractor, nil
+}
+
+// setFieldExtractor replaces the extractor with the same name or appends the extractor
+func setFieldExtractor(extractors []*fieldExtractor, extractor *fieldExtractor) []*fieldExtractor {
+	for i := range extractors {
+		if extractors[i].name == extractor.name {
+			extractors[i] = extractor
+			return extractors
+		}
+	}
+	return append(extractors, extractor)
+}
+
+// extractorFor returns the extractors of the group resource, resource specific fields override
+// the fields of `*` with the same name
+func (e extractors) extractorFor(gr schema.GroupResource) extractor {
+	var result []*fieldExtractor
+	for _, extractor := range e[anyResource] {
+		result = setFieldExtractor(result, extractor)
+	}
+	for _, extractor := range e[gr.String()] {
+		result = setFieldExtractor(result, extractor)
+	}
+	return result
+}
+
+type extractor []*fieldExtractor
+
+// mapping returns the mapping properties of the extracted fields
+func (e extractor) mapping() map[string]interface{} {
+	properties := make(map[string]interface{}, len(e))
+	for _, field := range e {
+		property := map[string]interface{}{"type": field.esType()}
+		if field.fieldType == ExtractedFieldKeyword {
+			property["ignore_above"] = 1024
+		}
+		properties[field.name] = property
+	}
+	return map[string]interface{}{
+		ExtractedPath: map[string]interface{}{
+			"properties": properties,
+		},
+	}
+}
+
+// extract returns the typed fields of the object, fields without values are omitted
+func (e extractor) extract(object map[string]interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	for _, field := range e {
+		if value := field.extract(object); value != nil {
+			fields[field.name] = value
+		}
+	}
+	return fields
+}
+
+// esType returns the Elasticsearch type of the field
+func (f *fieldExtractor) esType() string {
+	switch f.fieldType {
+	case ExtractedFieldQuantity, ExtractedFieldMilliQuantity:
+		return "long"
+	default:
+		return string(f.fieldType)
+	}
+}
+
+func (f *fieldExtractor) extract(object map[string]interface{}) interface{} {
+	var values []interface{}
+	var sum int64
+	seen := sets.NewString()
+	for _, path := range f.paths {
+		for _, value := range path.collect(object) {
+			converted, ok := f.convert(value)
+			if !ok {
+				continue
+			}
+			if f.sum {
+				sum += converted.(int64)
+				values = append(values, converted)
+				continue
+			}
+			key := fmt.Sprint(converted)
+			if seen.Has(key) {
+				continue
+			}
+			seen.Insert(key)
+			values = append(values, converted)
+		}
+	}
+	switch len(values) {
+	case 0:
+		return nil
+	case 1:
+		return values[0]
+	}
+	if f.sum {
+		return sum
+	}
+	return values
+}
+
+// convert converts the value to the type of the field, values of other types are skipped
+func (f *fieldExtractor) convert(value interface{}) (interface{}, bool) {
+	switch f.fieldType {
+	case ExtractedFieldLong:
+		switch v := value.(type) {
+		case int64:
+			return v, true
+		case float64:
+			return int64(v), true
+		}
+	case ExtractedFieldQuantity, ExtractedFieldMilliQuantity:
+		var quantity resource.Quantity
+		switch v := value.(type) {
+		case string:
+			parsed, err := resource.ParseQuantity(v)
+			if err != nil {
+				return nil, false
+			}
+			quantity = parsed
+		case int64:
+			quantity = *resource.NewQuantity(v, resource.DecimalSI)
+		case float64:
+			quantity = *resource.NewMilliQuantity(int64(v*1000), resource.DecimalSI)
+		default:
+			return nil, false
+		}
+		if f.fieldType == ExtractedFieldMilliQuantity {
+			return quantity.MilliValue(), true
+		}
+		return quantity.Value(), true
+	case ExtractedFieldBoolean:
+		v, ok := value.(bool)
+		return v, ok
+	case ExtractedFieldDate:
+		v, ok := value.(string)
+		return v, ok && v != ""
+	default:
+		switch v := value.(type) {
+		case string:
+			return v, v != ""
+		case int64, float64, bool:
+			return fmt.Sprint(v), true
+		}
+	}
+	return nil, false
+}
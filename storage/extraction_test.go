@@ -0,0 +1,48 @@
+package esstorage
+
+import (
+	"testing"
+)
+
+func TestQuantityExtractSum(t *testing.T) {
+	object := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"resources": map[string]interface{}{"requests": map[string]interface{}{"cpu": "250m", "memory": "64Mi"}}},
+				map[string]interface{}{"resources": map[string]interface{}{"requests": map[string]interface{}{"cpu": "1", "memory": "64Mi"}}},
+				map[string]interface{}{"resources": map[string]interface{}{}},
+			},
+		},
+	}
+	tests := []struct {
+		field ExtractedField
+		want  interface{}
+	}{
+		{
+			field: ExtractedField{Name: "cpu", Paths: []string{"spec.containers[*].resources.requests.cpu"}, Type: ExtractedFieldMilliQuantity, Sum: true},
+			want:  int64(1250),
+		},
+		{
+			field: ExtractedField{Name: "memory", Paths: []string{"spec.containers[*].resources.requests.memory"}, Type: ExtractedFieldQuantity, Sum: true},
+			want:  int64(128 * 1024 * 1024),
+		},
+		{
+			field: ExtractedField{Name: "limits", Paths: []string{"spec.containers[*].resources.limits.cpu"}, Type: ExtractedFieldMilliQuantity, Sum: true},
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		extractor, err := newFieldExtractor(tt.field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := extractor.extract(object); got != tt.want {
+			t.Errorf("extract(%s) = %v (%T), want %v", tt.field.Name, got, got, tt.want)
+		}
+	}
+
+	extractor := &fieldExtractor{name: "cpu", fieldType: ExtractedFieldMilliQuantity}
+	if _, ok := extractor.convert("lots"); ok {
+		t.Error("convert() of an invalid quantity should fail")
+	}
+}
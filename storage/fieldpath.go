@@ -0,0 +1,161 @@
+package esstorage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type segmentType int
+
+const (
+	keySegment segmentType = iota
+	indexSegment
+	wildcardSegment
+)
+
+type pathSegment struct {
+	segmentType segmentType
+	key         string
+	index       int
+}
+
+// fieldPath is a JSONPath-like path into an unstructured object, for example
+// `spec.containers[*].env[*].value`, `spec.containers[0].image` or `metadata.annotations['example.io/token']`.
+// `*` and `[*]` match every key of a map or every item of a list
+type fieldPath []pathSegment
+
+func parseFieldPath(path string) (fieldPath, error) {
+	var segments fieldPath
+	for i := 0; i < len(path); {
+		switch path[i] {
+		case '.':
+			i++
+		case '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("invalid path %q: unclosed bracket", path)
+			}
+			segment, err := parseBracketSegment(path[i+1 : i+end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %q: %w", path, err)
+			}
+			segments = append(segments, segment)
+			i += end + 1
+		default:
+			end := strings.IndexAny(path[i:], ".[")
+			if end == -1 {
+				end = len(path) - i
+			}
+			key := path[i : i+end]
+			if key == "*" {
+				segments = append(segments, pathSegment{segmentType: wildcardSegment})
+			} else {
+				segments = append(segments, pathSegment{segmentType: keySegment, key: key})
+			}
+			i += end
+		}
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("invalid path %q: empty path", path)
+	}
+	return segments, nil
+}
+
+func parseBracketSegment(content string) (pathSegment, error) {
+	switch {
+	case content == "*":
+		return pathSegment{segmentType: wildcardSegment}, nil
+	case len(content) >= 2 && (content[0] == '\'' || content[0] == '"') && content[len(content)-1] == content[0]:
+		return pathSegment{segmentType: keySegment, key: content[1 : len(content)-1]}, nil
+	default:
+		index, err := strconv.Atoi(content)
+		if err != nil || index < 0 {
+			return pathSegment{}, fmt.Errorf("invalid index %q", content)
+		}
+		return pathSegment{segmentType: indexSegment, index: index}, nil
+	}
+}
+
+// collect returns all the values matched by the path
+func (p fieldPath) collect(object interface{}) []interface{} {
+	var values []interface{}
+	p.walk(object, func(value interface{}) interface{} {
+		values = append(values, value)
+		return value
+	})
+	return values
+}
+
+// walk calls fn with every value matched by the path and replaces the value with the result
+func (p fieldPath) walk(object interface{}, fn func(value interface{}) interface{}) {
+	if len(p) == 0 {
+		return
+	}
+	segment, rest := p[0], p[1:]
+	visit := func(value interface{}) interface{} {
+		if len(rest) == 0 {
+			return fn(value)
+		}
+		rest.walk(value, fn)
+		return value
+	}
+
+	switch current := object.(type) {
+	case map[string]interface{}:
+		switch segment.segmentType {
+		case keySegment:
+			if value, ok := current[segment.key]; ok {
+				current[segment.key] = visit(value)
+			}
+		case wildcardSegment:
+			for key, value := range current {
+				current[key] = visit(value)
+			}
+		}
+	case []interface{}:
+		switch segment.segmentType {
+		case indexSegment:
+			if segment.index < len(current) {
+				current[segment.index] = visit(current[segment.index])
+			}
+		case wildcardSegment:
+			for i := range current {
+				current[i] = visit(current[i])
+			}
+		}
+	}
+}
+
+// remove deletes the map fields matched by the path and returns the removed values,
+// list items are not removed because removing them would shift the following items
+func (p fieldPath) remove(object map[string]interface{}) []interface{} {
+	var removed []interface{}
+	last := p[len(p)-1]
+	removeField := func(value interface{}) interface{} {
+		parent, ok := value.(map[string]interface{})
+		if !ok {
+			return value
+		}
+		switch last.segmentType {
+		case keySegment:
+			if field, ok := parent[last.key]; ok {
+				removed = append(removed, field)
+				delete(parent, last.key)
+			}
+		case wildcardSegment:
+			for key, field := range parent {
+				removed = append(removed, field)
+				delete(parent, key)
+			}
+		}
+		return value
+	}
+
+	if len(p) == 1 {
+		removeField(object)
+	} else {
+		p[:len(p)-1].walk(object, removeField)
+	}
+	return removed
+}
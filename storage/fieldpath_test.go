@@ -0,0 +1,58 @@
+package esstorage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFieldPath(t *testing.T) {
+	path, err := parseFieldPath("metadata.annotations['example.io/token']")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fieldPath{
+		{segmentType: keySegment, key: "metadata"},
+		{segmentType: keySegment, key: "annotations"},
+		{segmentType: keySegment, key: "example.io/token"},
+	}
+	if !reflect.DeepEqual(path, want) {
+		t.Errorf("parseFieldPath() = %+v, want %+v", path, want)
+	}
+
+	for _, path := range []string{"", "spec.containers[0", "spec.containers[-1]", `metadata.labels['app"]`} {
+		if _, err := parseFieldPath(path); err == nil {
+			t.Errorf("parseFieldPath(%q) should fail", path)
+		}
+	}
+}
+
+func TestFieldPathCollect(t *testing.T) {
+	object := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"image": "nginx", "env": []interface{}{
+					map[string]interface{}{"name": "A", "value": "1"},
+				}},
+				map[string]interface{}{"image": "envoy"},
+			},
+		},
+	}
+	tests := []struct {
+		path string
+		want []interface{}
+	}{
+		{path: "spec.containers[*].image", want: []interface{}{"nginx", "envoy"}},
+		{path: "spec.containers[1].image", want: []interface{}{"envoy"}},
+		{path: "spec.containers[2].image", want: nil},
+		{path: "spec.containers[*].env[*].value", want: []interface{}{"1"}},
+	}
+	for _, tt := range tests {
+		path, err := parseFieldPath(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := path.collect(object); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("collect(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
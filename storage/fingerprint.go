@@ -0,0 +1,294 @@
+package esstorage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	internal "github.com/clusterpedia-io/api/clusterpedia"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	FingerprintPath = "fingerprint"
+
+	// URLQueryDrift lists the objects of the name set by `names` whose spec deviates from the majority
+	// of the same-named objects across the clusters, each with the drift in the DriftAnnotation
+	URLQueryDrift = "drift"
+
+	// DriftAnnotation records the fingerprints and the field diffs from the majority spec in JSON
+	DriftAnnotation = "esstorage.clusterpedia.io/drift"
+
+	driftFingerprintsAggregation = "fingerprints"
+	driftClustersAggregation     = "clusters"
+	maxDriftClusters             = 1000
+)
+
+// defaultFingerprintIgnoredPaths are changed by autoscalers and rollout restarts in every cluster
+var defaultFingerprintIgnoredPaths = []string{
+	"spec.replicas",
+	"spec.template.metadata.annotations['kubectl.kubernetes.io/restartedAt']",
+}
+
+// FingerprintRule ignores volatile spec fields of a resource in the spec fingerprint
+type FingerprintRule struct {
+	// Resource is written as `resource.group`, for example `deployments.apps`,
+	// `*` applies the rule to every resource
+	Resource string `yaml:"resource"`
+
+	// IgnoredPaths are JSONPath-like paths under the spec, for example `spec.template.spec.containers[*].resources`
+	IgnoredPaths []string `yaml:"ignoredPaths"`
+}
+
+type fingerprinters map[string][]fieldPath
+
+func newFingerprinters(rules []FingerprintRule) (fingerprinters, error) {
+	rules = append([]FingerprintRule{{Resource: anyResource, IgnoredPaths: defaultFingerprintIgnoredPaths}}, rules...)
+
+	result := make(fingerprinters)
+	for i, rule := range rules {
+		if rule.Resource == "" {
+			return nil, fmt.Errorf("fingerprint rule %d: resource is required", i)
+		}
+		resource := rule.Resource
+		if resource != anyResource {
+			resource = schema.ParseGroupResource(resource).String()
+		}
+		for _, path := range rule.IgnoredPaths {
+			fieldPath, err := parseFieldPath(path)
+			if err != nil {
+				return nil, fmt.Errorf("fingerprint rule %d: %w", i, err)
+			}
+			result[resource] = append(result[resource], fieldPath)
+		}
+	}
+	return result, nil
+}
+
+// fingerprinterFor returns the fingerprinter of the group resource
+func (f fingerprinters) fingerprinterFor(gr schema.GroupResource) fingerprinter {
+	var result fingerprinter
+	result = append(result, f[anyResource]...)
+	result = append(result, f[gr.String()]...)
+	return result
+}
+
+// fingerprinter is the ignored paths of the spec
+type fingerprinter []fieldPath
+
+// normalize returns a copy of the spec of the object without the ignored fields, or nil if there is no spec
+func (f fingerprinter) normalize(object map[string]interface{}) map[string]interface{} {
+	spec, ok := object["spec"]
+	if !ok {
+		return nil
+	}
+	normalized := map[string]interface{}{"spec": runtime.DeepCopyJSONValue(spec)}
+	for _, path := range f {
+		path.remove(normalized)
+	}
+	return normalized
+}
+
+// fingerprint returns the sha256 of the normalized spec, map keys are sorted by the JSON encoding
+func (f fingerprinter) fingerprint(object map[string]interface{}) string {
+	normalized := f.normalize(object)
+	if normalized == nil {
+		return ""
+	}
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// DriftReport groups the same-named objects across clusters by the fingerprint of their specs
+type DriftReport struct {
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+
+	// Majority is the fingerprint shared by the most clusters
+	Majority string              `json:"majority"`
+	Groups   []*FingerprintGroup `json:"groups"`
+
+	// Deviating are the clusters whose fingerprint is not the majority
+	Deviating []string `json:"deviating,omitempty"`
+
+	// Diffs are the field diffs from the majority spec to the spec of each deviating cluster
+	Diffs map[string][]FieldDiff `json:"diffs,omitempty"`
+}
+
+// ObjectDrift is the drift of an object from the majority spec of the same-named objects
+type ObjectDrift struct {
+	Fingerprint string      `json:"fingerprint"`
+	Majority    string      `json:"majority"`
+	Diffs       []FieldDiff `json:"diffs,omitempty"`
+}
+
+type FingerprintGroup struct {
+	Fingerprint string   `json:"fingerprint"`
+	Clusters    []string `json:"clusters"`
+}
+
+// DetectDrift groups the objects with the name in all clusters by their spec fingerprints,
+// and reports the clusters which deviate from the majority, optionally with field-level diffs
+func (s *ResourceStorage) DetectDrift(ctx context.Context, namespace, name string, withDiff bool) (*DriftReport, error) {
+	builder := s.newDriftQueryBuilder(namespace, name)
+	builder.size = 0
+	fingerprints := newTermsAggregation(FingerprintPath, maxDriftClusters)
+	fingerprints["aggs"] = map[string]interface{}{
+		driftClustersAggregation: newTermsAggregation(ClusterPath, maxDriftClusters),
+	}
+	builder.addAggregation(driftFingerprintsAggregation, fingerprints)
+
+	r, err := s.index.Search(ctx, builder.build(), []string{s.indexName})
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := r.Aggregations[driftFingerprintsAggregation]
+	if !ok {
+		return nil, fmt.Errorf("aggregation %s is not found", driftFingerprintsAggregation)
+	}
+	var agg struct {
+		Buckets []struct {
+			Bucket
+			Clusters TermsAggregation `json:"clusters"`
+		} `json:"buckets"`
+	}
+	if err := json.Unmarshal(raw, &agg); err != nil {
+		return nil, err
+	}
+
+	report := &DriftReport{Namespace: namespace, Name: name}
+	for _, bucket := range agg.Buckets {
+		group := &FingerprintGroup{Fingerprint: bucket.KeyString()}
+		for _, cluster := range bucket.Clusters.Buckets {
+			group.Clusters = append(group.Clusters, cluster.KeyString())
+		}
+		sort.Strings(group.Clusters)
+		report.Groups = append(report.Groups, group)
+	}
+	if len(report.Groups) == 0 {
+		return report, nil
+	}
+
+	// the groups are ordered by the number of objects, ties are broken by the fingerprint
+	sort.SliceStable(report.Groups, func(i, j int) bool {
+		if len(report.Groups[i].Clusters) != len(report.Groups[j].Clusters) {
+			return len(report.Groups[i].Clusters) > len(report.Groups[j].Clusters)
+		}
+		return report.Groups[i].Fingerprint < report.Groups[j].Fingerprint
+	})
+	report.Majority = report.Groups[0].Fingerprint
+	for _, group := range report.Groups[1:] {
+		report.Deviating = append(report.Deviating, group.Clusters...)
+	}
+	sort.Strings(report.Deviating)
+
+	if withDiff && len(report.Deviating) > 0 {
+		specs, err := s.getNormalizedSpecs(ctx, namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		majority := specs[report.Groups[0].Clusters[0]]
+		report.Diffs = make(map[string][]FieldDiff, len(report.Deviating))
+		for _, cluster := range report.Deviating {
+			report.Diffs[cluster] = diffObjects(majority, specs[cluster])
+		}
+	}
+	return report, nil
+}
+
+// getListDrift returns the drift report of the name in the list options, or nil if the drift option is not set
+func (s *ResourceStorage) getListDrift(ctx context.Context, opts *internal.ListOptions) (*DriftReport, error) {
+	if !opts.URLQuery.Has(URLQueryDrift) {
+		return nil, nil
+	}
+	drift, err := strconv.ParseBool(opts.URLQuery.Get(URLQueryDrift))
+	if err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid %s: %v", URLQueryDrift, err))
+	}
+	if !drift {
+		return nil, nil
+	}
+	if len(opts.Names) != 1 || len(opts.Namespaces) > 1 {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("%s requires a single name and at most one namespace", URLQueryDrift))
+	}
+	var namespace string
+	if len(opts.Namespaces) == 1 {
+		namespace = opts.Namespaces[0]
+	}
+	return s.DetectDrift(ctx, namespace, opts.Names[0], true)
+}
+
+// newDriftExpression matches the objects of the deviating clusters, it never matches if no cluster deviates
+func newDriftExpression(report *DriftReport) Expression {
+	return NewTerms(ClusterPath, append([]string{}, report.Deviating...))
+}
+
+// setDriftAnnotation records the drift of the object in the cluster, the fingerprint is the group of the cluster
+func setDriftAnnotation(obj runtime.Object, report *DriftReport, cluster string) error {
+	if report == nil {
+		return nil
+	}
+	drift := &ObjectDrift{Majority: report.Majority, Diffs: report.Diffs[cluster]}
+	for _, group := range report.Groups {
+		for _, groupCluster := range group.Clusters {
+			if groupCluster == cluster {
+				drift.Fingerprint = group.Fingerprint
+			}
+		}
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(drift)
+	if err != nil {
+		return err
+	}
+	annotations := accessor.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[DriftAnnotation] = string(value)
+	accessor.SetAnnotations(annotations)
+	return nil
+}
+
+func (s *ResourceStorage) newDriftQueryBuilder(namespace, name string) *QueryBuilder {
+	builder := NewQueryBuilder()
+	builder.addExpression(NewTerms(GroupPath, []string{s.storageGroupResource.Group}))
+	builder.addExpression(NewTerms(ResourcePath, []string{s.storageGroupResource.Resource}))
+	builder.addExpression(NewTerms(NamePath, []string{name}))
+	if namespace != "" {
+		builder.addExpression(NewTerms(NameSpacePath, []string{namespace}))
+	}
+	builder.addExpression(newNotDeletedExpression())
+	return builder
+}
+
+// getNormalizedSpecs returns the normalized specs of the objects with the name by cluster
+func (s *ResourceStorage) getNormalizedSpecs(ctx context.Context, namespace, name string) (map[string]map[string]interface{}, error) {
+	builder := s.newDriftQueryBuilder(namespace, name)
+	builder.size = maxDriftClusters
+	builder.source = []string{"object.spec", "object.metadata.annotations"}
+
+	r, err := s.index.Search(ctx, builder.build(), []string{s.indexName})
+	if err != nil {
+		return nil, err
+	}
+	specs := make(map[string]map[string]interface{}, len(r.Hits.Hits))
+	for _, resource := range r.GetResources() {
+		specs[getClusterName(resource.GetObject())] = s.fingerprinter.normalize(resource.GetObject())
+	}
+	return specs, nil
+}
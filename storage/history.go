@@ -0,0 +1,164 @@
+package esstorage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+)
+
+const (
+	historyAlias = "clusterpedia-history"
+
+	RevisionPath          = "revision"
+	RevisionTimestampPath = "revision.timestamp"
+	RevisionUntilPath     = "revision.until"
+	RevisionOperationPath = "revision.operation"
+
+	// URLQueryAsOf lists the resources as they were at the time, it accepts RFC3339 times and
+	// relative times like `now-1h`, and requires the history of the resource.
+	// an object is got as it was at the time by listing it with its name
+	URLQueryAsOf = "asOf"
+
+	revisionOperationUpsert = "upsert"
+	revisionOperationDelete = "delete"
+
+	defaultHistoryRetention = "30d"
+	historyPurgeInterval    = time.Hour
+)
+
+// HistoryConfig appends every revision of the objects to a history index per resource
+type HistoryConfig struct {
+	// Resources are written as `resource.group`, for example `deployments.apps`, `*` enables the history of every resource
+	Resources []string `yaml:"resources"`
+
+	// Retention is how long the superseded and deleted revisions are kept, in Elasticsearch time units, it defaults to 30d
+	Retention string `yaml:"retention"`
+}
+
+func (c *HistoryConfig) Enabled(gr schema.GroupResource) bool {
+	set := groupResourceSet(c.Resources)
+	return set.Has(anyResource) || set.Has(gr.String())
+}
+
+func (c *HistoryConfig) validate() error {
+	if c.Retention == "" {
+		c.Retention = defaultHistoryRetention
+	}
+	if !dateMathRegexp.MatchString("now-" + c.Retention) {
+		return fmt.Errorf("history: invalid retention %q", c.Retention)
+	}
+	return nil
+}
+
+func generateHistoryIndexName(group, resource string) string {
+	return fmt.Sprintf("%s-history-%s-%s", indexPrefix, group, resource)
+}
+
+var revisionMapping = map[string]interface{}{
+	RevisionPath: map[string]interface{}{
+		"properties": map[string]interface{}{
+			"cluster":   map[string]interface{}{"type": "keyword"},
+			"operation": map[string]interface{}{"type": "keyword"},
+			"timestamp": map[string]interface{}{"type": "date"},
+			"until":     map[string]interface{}{"type": "date"},
+		},
+	},
+}
+
+// newAsOfExpressions matches the revisions which were current at the time
+func newAsOfExpressions(asOf string) []Expression {
+	created := NewDateRange(RevisionTimestampPath, "", asOf)
+	superseded := NewDateRange(RevisionUntilPath, "", asOf)
+	superseded.SetLogicType(MustNot)
+	deleted := NewTerms(RevisionOperationPath, []string{revisionOperationDelete})
+	deleted.SetLogicType(MustNot)
+	return []Expression{created, superseded, deleted}
+}
+
+// historyIndexFor returns the searched index, which is the history index if the option is answered from the history
+func (s *ResourceStorage) historyIndexFor(historical bool, option string) (string, error) {
+	if !historical {
+		return s.indexName, nil
+	}
+	if s.historyIndex == "" {
+		return "", apierrors.NewBadRequest(fmt.Sprintf("%s requires the history of %s", option, s.storageGroupResource))
+	}
+	return s.historyIndex, nil
+}
+
+// previousDocument returns the stored document of the object before it is written, the history only needs
+// its resource version while the percolator needs the whole document if there are queries of the resource
+func (s *ResourceStorage) previousDocument(ctx context.Context, uid string) (map[string]interface{}, error) {
+	switch {
+	case s.percolator != nil && s.percolator.hasQueries(s.storageGroupResource):
+		return s.index.GetSource(ctx, s.indexName, uid)
+	case s.historyIndex != "":
+		return s.index.GetSource(ctx, s.indexName, uid, "object.metadata.resourceVersion")
+	default:
+		return nil, nil
+	}
+}
+
+func resourceVersionOf(doc map[string]interface{}) string {
+	resourceVersion, _ := simpleMapExtract("object.metadata.resourceVersion", doc).(string)
+	return resourceVersion
+}
+
+// appendRevision supersedes the previous revision and appends the revision of the operation to the history index,
+// the previous revision is updated by id because updates by query do not see the unrefreshed revisions
+func (s *ResourceStorage) appendRevision(ctx context.Context, cluster, uid, previous, resourceVersion, operation string, doc map[string]interface{}) error {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	if previous != "" && (previous != resourceVersion || operation == revisionOperationDelete) {
+		err := s.index.Update(ctx, s.historyIndex, revisionID(uid, previous, revisionOperationUpsert), map[string]interface{}{
+			RevisionPath: map[string]interface{}{"until": now},
+		})
+		if esError, ok := err.(*ESError); err != nil && !(ok && esError.StatusCode == http.StatusNotFound) {
+			return err
+		}
+	}
+
+	revision := map[string]interface{}{
+		"cluster":   cluster,
+		"operation": operation,
+		"timestamp": now,
+	}
+	if operation == revisionOperationDelete {
+		revision["until"] = now
+	}
+	revisionDoc := make(map[string]interface{}, len(doc)+1)
+	for key, value := range doc {
+		revisionDoc[key] = value
+	}
+	revisionDoc[RevisionPath] = revision
+
+	err := s.index.Create(ctx, s.historyIndex, revisionID(uid, resourceVersion, operation), revisionDoc)
+	if esError, ok := err.(*ESError); ok && esError.StatusCode == http.StatusConflict {
+		return nil
+	}
+	return err
+}
+
+func revisionID(uid, resourceVersion, operation string) string {
+	if operation == revisionOperationDelete {
+		return uid + "-" + resourceVersion + "-" + operation
+	}
+	return uid + "-" + resourceVersion
+}
+
+// purgeHistory deletes the revisions superseded or deleted before the retention periodically
+func (s *StorageFactory) purgeHistory() {
+	ticker := time.NewTicker(historyPurgeInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		builder := NewQueryBuilder()
+		builder.addExpression(NewDateRange(RevisionUntilPath, "", "now-"+s.config.History.Retention))
+		if err := s.index.DeleteByQuery(context.Background(), builder.build(), historyAlias); err != nil {
+			klog.ErrorS(err, "Failed to purge the history", "retention", s.config.History.Retention)
+		}
+	}
+}
@@ -115,6 +115,44 @@ func (s *Index) Search(ctx context.Context, query map[string]interface{}, indexN
 	return &r, nil
 }
 
+// SearchSources returns the sources of the hits, for the indices whose documents are not resources
+func (s *Index) SearchSources(ctx context.Context, query map[string]interface{}, indexNames []string) ([]map[string]interface{}, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(query); err != nil {
+		return nil, fmt.Errorf("error encoding query: %s", err)
+	}
+	res, err := s.client.Search(
+		s.client.Search.WithContext(ctx),
+		s.client.Search.WithIndex(indexNames...),
+		s.client.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, &ESError{
+			StatusCode: res.StatusCode,
+			Message:    res.String(),
+		}
+	}
+	var r struct {
+		Hits struct {
+			Hits []struct {
+				Source map[string]interface{} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+	sources := make([]map[string]interface{}, 0, len(r.Hits.Hits))
+	for _, hit := range r.Hits.Hits {
+		sources = append(sources, hit.Source)
+	}
+	return sources, nil
+}
+
 func (s *Index) DeleteByQuery(ctx context.Context, query map[string]interface{}, indexName ...string) error {
 	var buf bytes.Buffer
 	if err := json.NewEncoder(&buf).Encode(query); err != nil {
@@ -179,6 +217,334 @@ func (s *Index) Upsert(ctx context.Context, indexName string, uid string, doc ma
 	return nil
 }
 
+// GetSource returns the source of the document, or nil if the document is not found
+func (s *Index) GetSource(ctx context.Context, indexName string, id string, includes ...string) (map[string]interface{}, error) {
+	req := esapi.GetRequest{
+		Index:          indexName,
+		DocumentID:     id,
+		SourceIncludes: includes,
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == 404 {
+		return nil, nil
+	}
+	if res.IsError() {
+		return nil, &ESError{
+			StatusCode: res.StatusCode,
+			Message:    res.String(),
+		}
+	}
+	var r struct {
+		Source map[string]interface{} `json:"_source"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+	return r.Source, nil
+}
+
+// DocumentVersion is the sequence number and the primary term of the last write of a document,
+// the writes guarded by it fail with 409 if the document is changed concurrently
+type DocumentVersion struct {
+	SeqNo       int `json:"_seq_no"`
+	PrimaryTerm int `json:"_primary_term"`
+}
+
+// GetVersionedSource returns the source of the document with its version, or nil if the document is not found
+func (s *Index) GetVersionedSource(ctx context.Context, indexName string, id string) (map[string]interface{}, *DocumentVersion, error) {
+	req := esapi.GetRequest{
+		Index:      indexName,
+		DocumentID: id,
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == 404 {
+		return nil, nil, nil
+	}
+	if res.IsError() {
+		return nil, nil, &ESError{
+			StatusCode: res.StatusCode,
+			Message:    res.String(),
+		}
+	}
+	var r struct {
+		DocumentVersion
+		Source map[string]interface{} `json:"_source"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, nil, err
+	}
+	return r.Source, &r.DocumentVersion, nil
+}
+
+// ReplaceIfVersion replaces the document only if it is not written since the version
+func (s *Index) ReplaceIfVersion(ctx context.Context, indexName string, id string, doc map[string]interface{}, version *DocumentVersion) error {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("marshal json error %v", err)
+	}
+
+	req := esapi.IndexRequest{
+		DocumentID:    id,
+		Body:          bytes.NewReader(body),
+		Index:         indexName,
+		IfSeqNo:       &version.SeqNo,
+		IfPrimaryTerm: &version.PrimaryTerm,
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return err
+	}
+	if res.IsError() {
+		return &ESError{
+			StatusCode: res.StatusCode,
+			Message:    res.String(),
+		}
+	}
+	return nil
+}
+
+// DeleteIfVersion deletes the document only if it is not written since the version
+func (s *Index) DeleteIfVersion(ctx context.Context, indexName string, id string, version *DocumentVersion) error {
+	req := esapi.DeleteRequest{
+		Index:         indexName,
+		DocumentID:    id,
+		IfSeqNo:       &version.SeqNo,
+		IfPrimaryTerm: &version.PrimaryTerm,
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return err
+	}
+	if res.IsError() {
+		return &ESError{
+			StatusCode: res.StatusCode,
+			Message:    res.String(),
+		}
+	}
+	return nil
+}
+
+// Update merges the partial document into the existing document
+func (s *Index) Update(ctx context.Context, indexName string, id string, doc map[string]interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"doc": doc})
+	if err != nil {
+		return fmt.Errorf("marshal json error %v", err)
+	}
+
+	req := esapi.UpdateRequest{
+		Index:      indexName,
+		DocumentID: id,
+		Body:       bytes.NewReader(body),
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return err
+	}
+	if res.IsError() {
+		return &ESError{
+			StatusCode: res.StatusCode,
+			Message:    res.String(),
+		}
+	}
+	return nil
+}
+
+// Create indexes the document only if the id does not exist, it is the only write operation of data streams
+func (s *Index) Create(ctx context.Context, indexName string, id string, doc map[string]interface{}) error {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("marshal json error %v", err)
+	}
+
+	req := esapi.IndexRequest{
+		DocumentID: id,
+		Body:       bytes.NewReader(body),
+		Index:      indexName,
+		OpType:     "create",
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return err
+	}
+	if res.IsError() {
+		return &ESError{
+			StatusCode: res.StatusCode,
+			Message:    res.String(),
+		}
+	}
+	return nil
+}
+
+// PutLifecyclePolicy creates or updates the ILM policy
+func (s *Index) PutLifecyclePolicy(ctx context.Context, name string, policy map[string]interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"policy": policy})
+	if err != nil {
+		return fmt.Errorf("marshal json error %v", err)
+	}
+
+	req := esapi.ILMPutLifecycleRequest{
+		Policy: name,
+		Body:   bytes.NewReader(body),
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return err
+	}
+	if res.IsError() {
+		return &ESError{
+			StatusCode: res.StatusCode,
+			Message:    res.String(),
+		}
+	}
+	return nil
+}
+
+// PutIndexTemplate creates or updates the composable index template
+func (s *Index) PutIndexTemplate(ctx context.Context, name string, template map[string]interface{}) error {
+	body, err := json.Marshal(template)
+	if err != nil {
+		return fmt.Errorf("marshal json error %v", err)
+	}
+
+	req := esapi.IndicesPutIndexTemplateRequest{
+		Name: name,
+		Body: bytes.NewReader(body),
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return err
+	}
+	if res.IsError() {
+		return &ESError{
+			StatusCode: res.StatusCode,
+			Message:    res.String(),
+		}
+	}
+	return nil
+}
+
+// IsDataStream reports whether the name is an existing data stream
+func (s *Index) IsDataStream(ctx context.Context, name string) (bool, error) {
+	req := esapi.IndicesGetDataStreamRequest{
+		Name: []string{name},
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return false, err
+	}
+	if res.StatusCode == 404 {
+		return false, nil
+	}
+	if res.IsError() {
+		return false, &ESError{
+			StatusCode: res.StatusCode,
+			Message:    res.String(),
+		}
+	}
+	return true, nil
+}
+
+// Exists reports whether the index, alias or data stream exists
+func (s *Index) Exists(ctx context.Context, name string) (bool, error) {
+	req := esapi.IndicesExistsRequest{
+		Index: []string{name},
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case res.StatusCode == 404:
+		return false, nil
+	case res.IsError():
+		return false, &ESError{
+			StatusCode: res.StatusCode,
+			Message:    res.String(),
+		}
+	}
+	return true, nil
+}
+
+// PutMapping adds the properties to the mapping of the index
+func (s *Index) PutMapping(ctx context.Context, indexName string, properties map[string]interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"properties": properties})
+	if err != nil {
+		return fmt.Errorf("marshal json error %v", err)
+	}
+
+	req := esapi.IndicesPutMappingRequest{
+		Index: []string{indexName},
+		Body:  bytes.NewReader(body),
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return err
+	}
+	if res.IsError() {
+		return &ESError{
+			StatusCode: res.StatusCode,
+			Message:    res.String(),
+		}
+	}
+	return nil
+}
+
+// OpenPointInTime opens a point in time of the indices and returns its id
+func (s *Index) OpenPointInTime(ctx context.Context, indexNames []string, keepAlive string) (string, error) {
+	req := esapi.OpenPointInTimeRequest{
+		Index:     indexNames,
+		KeepAlive: keepAlive,
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return "", err
+	}
+	if res.IsError() {
+		return "", &ESError{
+			StatusCode: res.StatusCode,
+			Message:    res.String(),
+		}
+	}
+	defer res.Body.Close()
+	var r struct {
+		Id string `json:"id"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return "", err
+	}
+	return r.Id, nil
+}
+
+func (s *Index) ClosePointInTime(ctx context.Context, id string) error {
+	body, err := json.Marshal(map[string]interface{}{"id": id})
+	if err != nil {
+		return fmt.Errorf("marshal json error %v", err)
+	}
+
+	req := esapi.ClosePointInTimeRequest{
+		Body: bytes.NewReader(body),
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return err
+	}
+	if res.IsError() {
+		return &ESError{
+			StatusCode: res.StatusCode,
+			Message:    res.String(),
+		}
+	}
+	return nil
+}
+
 func (s *Index) ListIndex() ([]string, error) {
 	resp, err := s.client.Cat.Indices()
 	if err != nil {
@@ -1,9 +1,11 @@
 package esstorage
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
 )
 
 const (
@@ -21,6 +23,36 @@ var mappingTemplate = `{
       "number_of_shards": 1,
       "auto_expand_replicas": "0-1",
       "number_of_replicas": 0
+    },
+    "analysis": {
+      "tokenizer": {
+        "k8s_object_tokenizer": {
+          "type": "pattern",
+          "pattern": "[\\p{L}\\p{N}][\\p{L}\\p{N}._:/@+-]*",
+          "group": 0
+        }
+      },
+      "filter": {
+        "k8s_object_delimiter": {
+          "type": "word_delimiter_graph",
+          "preserve_original": true,
+          "split_on_case_change": false,
+          "split_on_numerics": false,
+          "stem_english_possessive": false
+        }
+      },
+      "analyzer": {
+        "k8s_object": {
+          "type": "custom",
+          "tokenizer": "k8s_object_tokenizer",
+          "filter": ["lowercase", "k8s_object_delimiter", "flatten_graph"]
+        },
+        "k8s_object_search": {
+          "type": "custom",
+          "tokenizer": "k8s_object_tokenizer",
+          "filter": ["lowercase", "k8s_object_delimiter"]
+        }
+      }
     }
   },
   "mappings": {
@@ -38,18 +70,79 @@ var mappingTemplate = `{
         "type": "keyword"
       },
       "name": {
-        "type": "keyword"
+        "type": "keyword",
+        "fields": {
+          "suggest": {
+            "type": "search_as_you_type"
+          },
+          "wildcard": {
+            "type": "wildcard"
+          }
+        }
       },
       "namespace": {
-        "type": "keyword"
+        "type": "keyword",
+        "fields": {
+          "wildcard": {
+            "type": "wildcard"
+          }
+        }
       },
       "resource_version": {
         "type": "keyword"
       },
+      "fingerprint": {
+        "type": "keyword"
+      },
+      "conditions": {
+        "type": "nested",
+        "properties": {
+          "type": {
+            "type": "keyword"
+          },
+          "status": {
+            "type": "keyword"
+          },
+          "reason": {
+            "type": "keyword"
+          },
+          "lastTransitionTime": {
+            "type": "date",
+            "format": "strict_date_optional_time||epoch_second"
+          }
+        }
+      },
+      "custom": {
+        "properties": {
+          "labelKeys": {
+            "type": "keyword"
+          },
+          "annotationKeys": {
+            "type": "keyword"
+          },
+          "fullTextObject": {
+            "type": "text",
+            "store": true,
+            "analyzer": "k8s_object",
+            "search_analyzer": "k8s_object_search"
+          }
+        }
+      },
       "object": {
+        "dynamic": %s,
         "properties": {
+          "apiVersion": {
+            "type": "keyword"
+          },
+          "kind": {
+            "type": "keyword"
+          },
           "metadata": {
+            "dynamic": true,
             "properties": {
+              "uid": {
+                "type": "keyword"
+              },
               "annotations": {
                 "type": "flattened"
               },
@@ -59,11 +152,11 @@ var mappingTemplate = `{
               },
               "creationTimestamp": {
                 "type": "date",
-                "format": "yyyy-MM-dd'T'HH:mm:ss'Z'"
+                "format": "strict_date_optional_time||epoch_second"
               },
               "deletionTimestamp": {
                 "type": "date", 
-                "format": "yyyy-MM-dd'T'HH:mm:ss'Z'"
+                "format": "strict_date_optional_time||epoch_second"
               },
               "labels": {
                 "type": "flattened"
@@ -95,7 +188,12 @@ var common = `
         "type":"flattened",
         "ignore_above": 1024,
         "depth_limit": 200
-    }	
+    },
+    "status":{
+        "type":"flattened",
+        "ignore_above": 1024,
+        "depth_limit": %d
+    }
 `
 var configmap = `
     "data": {
@@ -119,6 +217,24 @@ var secret = `
 `
 
 var event = `
+    "reason": {
+        "type": "keyword"
+    },
+    "type": {
+        "type": "keyword"
+    },
+    "message": {
+        "type": "text"
+    },
+    "count": {
+        "type": "long"
+    },
+    "action": {
+        "type": "keyword"
+    },
+    "reportingComponent": {
+        "type": "keyword"
+    },
     "involvedObject": {
         "type": "flattened"
     },
@@ -127,15 +243,15 @@ var event = `
     },
     "firstTimestamp": {
         "type": "date", 
-		"format": "yyyy-MM-dd'T'HH:mm:ss'Z'"
+		"format": "strict_date_optional_time||epoch_second"
     },
     "lastTimestamp": {
         "type": "date", 
-		"format": "yyyy-MM-dd'T'HH:mm:ss'Z'"
+		"format": "strict_date_optional_time||epoch_second"
     },
     "eventTime": {
         "type": "date", 
-		"format": "yyyy-MM-dd'T'HH:mm:ss.'Z'"
+		"format": "strict_date_optional_time||epoch_second"
     },
     "related": {
         "type": "flattened"
@@ -145,16 +261,122 @@ var event = `
     }
 `
 
-func GetIndexMapping(alias string, storageGroupResource schema.GroupResource) string {
-	resource := storageGroupResource.Resource
-	switch resource {
+const defaultStatusDepthLimit = 50
+
+// MappingOverride customizes the mapping of the object fields of a resource
+type MappingOverride struct {
+	// Resource is written as `resource.group`, for example `applications.argoproj.io`
+	Resource string `yaml:"resource"`
+
+	// Dynamic is the dynamic mapping of the unknown top-level object fields,
+	// it defaults to `false` which stores but does not index them
+	Dynamic string `yaml:"dynamic"`
+
+	// StatusDepthLimit is the depth limit of the flattened status
+	StatusDepthLimit int `yaml:"statusDepthLimit"`
+
+	// Properties are additional mappings of the top-level object fields in JSON, for example
+	// `{"data": {"type": "flattened"}}`, the built-in fields such as `metadata` and `spec` cannot be overridden
+	Properties string `yaml:"properties"`
+}
+
+func validateMappingOverrides(overrides []MappingOverride) (map[schema.GroupResource]*MappingOverride, error) {
+	result := make(map[schema.GroupResource]*MappingOverride, len(overrides))
+	for i := range overrides {
+		override := &overrides[i]
+		gr := schema.ParseGroupResource(override.Resource)
+		if _, ok := result[gr]; ok {
+			return nil, fmt.Errorf("mapping: duplicate resource %s", gr)
+		}
+		switch override.Dynamic {
+		case "", "true", "false", "runtime":
+		default:
+			return nil, fmt.Errorf("mapping %s: unsupported dynamic %q", gr, override.Dynamic)
+		}
+		if _, err := GetIndexMapping("", gr, override); err != nil {
+			return nil, err
+		}
+		result[gr] = override
+	}
+	return result, nil
+}
+
+func GetIndexMapping(alias string, storageGroupResource schema.GroupResource, override *MappingOverride) (string, error) {
+	dynamic, statusDepthLimit := "false", defaultStatusDepthLimit
+	if override != nil {
+		if override.Dynamic != "" {
+			dynamic = override.Dynamic
+		}
+		if override.StatusDepthLimit > 0 {
+			statusDepthLimit = override.StatusDepthLimit
+		}
+	}
+	if dynamic == "runtime" {
+		dynamic = `"runtime"`
+	}
+
+	var properties string
+	switch storageGroupResource.Resource {
 	case ResourceConfigmap:
-		return fmt.Sprintf(mappingTemplate, alias, configmap)
+		properties = configmap
 	case ResourceSecret:
-		return fmt.Sprintf(mappingTemplate, alias, secret)
+		properties = secret
 	case ResourceEvent:
-		return fmt.Sprintf(mappingTemplate, alias, event)
+		properties = event
 	default:
-		return fmt.Sprintf(mappingTemplate, alias, common)
+		properties = fmt.Sprintf(common, statusDepthLimit)
+	}
+	mapping := fmt.Sprintf(mappingTemplate, alias, dynamic, properties)
+	if override == nil || override.Properties == "" {
+		return mapping, nil
+	}
+
+	// the properties of the override are merged into the object properties
+	var overrideProperties map[string]interface{}
+	if err := json.Unmarshal([]byte(override.Properties), &overrideProperties); err != nil {
+		return "", fmt.Errorf("mapping %s: invalid properties: %w", storageGroupResource, err)
+	}
+	var template map[string]interface{}
+	if err := json.Unmarshal([]byte(mapping), &template); err != nil {
+		return "", err
+	}
+	objectProperties, ok := simpleMapExtract("mappings.properties.object.properties", template).(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("mapping %s: the template has no object properties", storageGroupResource)
+	}
+	for field, fieldMapping := range overrideProperties {
+		if _, ok := objectProperties[field]; ok {
+			return "", fmt.Errorf("mapping %s: the properties cannot override the built-in field %s", storageGroupResource, field)
+		}
+		objectProperties[field] = fieldMapping
+	}
+	data, err := json.Marshal(template)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// indexedObjectFields returns the top-level object fields which are indexed by the mapping,
+// it returns nil if the unknown fields are mapped dynamically
+func indexedObjectFields(mapping string) (sets.String, error) {
+	var template map[string]interface{}
+	if err := json.Unmarshal([]byte(mapping), &template); err != nil {
+		return nil, err
+	}
+	if dynamic := simpleMapExtract("mappings.properties.object.dynamic", template); dynamic != false && dynamic != "false" {
+		return nil, nil
+	}
+	properties, ok := simpleMapExtract("mappings.properties.object.properties", template).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("the mapping has no object properties")
+	}
+	fields := sets.NewString()
+	for field, value := range properties {
+		if property, ok := value.(map[string]interface{}); ok && property["enabled"] == false {
+			continue
+		}
+		fields.Insert(field)
 	}
+	return fields, nil
 }
@@ -0,0 +1,65 @@
+package esstorage
+
+import (
+	"testing"
+
+	internal "github.com/clusterpedia-io/api/clusterpedia"
+	"github.com/clusterpedia-io/api/clusterpedia/fields"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestGetIndexMappingOverride(t *testing.T) {
+	gr := schema.GroupResource{Group: "argoproj.io", Resource: "applications"}
+
+	mapping, err := GetIndexMapping("alias", gr, &MappingOverride{Properties: `{"operation": {"type": "flattened"}}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexed, err := indexedObjectFields(mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"apiVersion", "kind", "metadata", "spec", "status", "operation"} {
+		if !indexed.Has(field) {
+			t.Errorf("%s is not indexed", field)
+		}
+	}
+
+	s := &ResourceStorage{storageGroupResource: gr, indexedFields: indexed}
+	for selector, wantErr := range map[string]bool{"spec.project=default": false, "operation.sync=true": false, "revision=main": true} {
+		fieldSelector, err := fields.Parse(selector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := &internal.ListOptions{EnhancedFieldSelector: fieldSelector}
+		if err := s.validateFieldSelector(opts); (err != nil) != wantErr {
+			t.Errorf("validateFieldSelector(%s) error = %v, wantErr %v", selector, err, wantErr)
+		}
+	}
+
+	for _, properties := range []string{`{"metadata": {"type": "flattened"}}`, `{"spec": {"type": "object"}}`, `{"kind": {"type": "text"}}`} {
+		if _, err := GetIndexMapping("alias", gr, &MappingOverride{Properties: properties}); err == nil {
+			t.Errorf("override %s of a built-in field should be rejected", properties)
+		}
+	}
+
+	mapping, err = GetIndexMapping("alias", schema.GroupResource{Resource: ResourceConfigmap}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if indexed, err = indexedObjectFields(mapping); err != nil {
+		t.Fatal(err)
+	}
+	if indexed.Has("data") {
+		t.Error("the disabled data of configmaps should not be indexed")
+	}
+
+	mapping, err = GetIndexMapping("alias", gr, &MappingOverride{Dynamic: "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if indexed, err = indexedObjectFields(mapping); err != nil || indexed != nil {
+		t.Errorf("indexedObjectFields() = %v, %v, want all the fields of the dynamic mapping", indexed, err)
+	}
+}
@@ -0,0 +1,66 @@
+package esstorage
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+// The metrics are published by expvar, the clusterpedia apiserver does not serve them,
+// so they are served by the metrics server of the storage when its address is configured
+var (
+	// prunedBytes is the size of the JSON pruned before storing, by resource
+	prunedBytes = expvar.NewMap("esstorage_pruned_bytes_total")
+
+	// mappingRejections is the number of documents rejected by mapping, by resource
+	mappingRejections = expvar.NewMap("esstorage_mapping_rejections_total")
+)
+
+// counterVecs are the counters by resource served in the Prometheus text format
+var counterVecs = []struct {
+	name, help string
+	values     *expvar.Map
+}{
+	{"esstorage_pruned_bytes_total", "The size of the JSON pruned before storing.", prunedBytes},
+	{"esstorage_mapping_rejections_total", "The number of documents rejected by mapping.", mappingRejections},
+}
+
+// MetricsConfig configures the metrics server of the storage
+type MetricsConfig struct {
+	// Address is the listen address of the metrics server, for example `:9464`, the metrics are not served
+	// if it is empty. `/metrics` serves the counters in the Prometheus text format and `/debug/vars` serves expvar
+	Address string `yaml:"address"`
+}
+
+var serveMetricsOnce sync.Once
+
+// serveMetrics starts the metrics server once, errors are logged because the metrics are optional
+func serveMetrics(config *MetricsConfig) {
+	if config.Address == "" {
+		return
+	}
+	serveMetricsOnce.Do(func() {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", writeMetrics)
+		mux.Handle("/debug/vars", expvar.Handler())
+		go func() {
+			if err := http.ListenAndServe(config.Address, mux); err != nil {
+				klog.ErrorS(err, "Failed to serve the storage metrics", "address", config.Address)
+			}
+		}()
+	})
+}
+
+// writeMetrics writes the counters in the Prometheus text format
+func writeMetrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, counter := range counterVecs {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", counter.name, counter.help, counter.name)
+		counter.values.Do(func(kv expvar.KeyValue) {
+			fmt.Fprintf(w, "%s{resource=%q} %s\n", counter.name, kv.Key, kv.Value.String())
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package esstorage
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	prunedBytes.Add("deployments.apps", 42)
+
+	recorder := httptest.NewRecorder()
+	writeMetrics(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+	for _, line := range []string{
+		"# TYPE esstorage_pruned_bytes_total counter\n",
+		`esstorage_pruned_bytes_total{resource="deployments.apps"} 42` + "\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("metrics do not contain %q:\n%s", line, body)
+		}
+	}
+}
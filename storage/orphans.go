@@ -0,0 +1,154 @@
+package esstorage
+
+import (
+	"context"
+	"strconv"
+
+	internal "github.com/clusterpedia-io/api/clusterpedia"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	// URLQueryOrphaned lists the resources which have an owner reference to an object that no longer exists
+	// in the same cluster. Owners of resources that are not synchronized are also reported as missing
+	URLQueryOrphaned = "orphaned"
+
+	orphanOwnersAggregation = "owners"
+	orphanOwnersPageSize    = 1000
+)
+
+// newOrphanExpression returns the query of the orphaned resources, or nil if the orphaned option is not set
+func (s *ResourceStorage) newOrphanExpression(ctx context.Context, opts *internal.ListOptions) (Expression, error) {
+	if !opts.URLQuery.Has(URLQueryOrphaned) {
+		return nil, nil
+	}
+	orphaned, err := strconv.ParseBool(opts.URLQuery.Get(URLQueryOrphaned))
+	if err != nil {
+		return nil, apierrors.NewBadRequest("invalid orphaned: " + err.Error())
+	}
+	if !orphaned {
+		return nil, nil
+	}
+
+	owners, err := s.getReferencedOwners(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	orphans := NewBoolExpression()
+	for cluster, uids := range owners {
+		missing, err := s.getMissingUIDs(ctx, cluster, uids.List())
+		if err != nil {
+			return nil, err
+		}
+		// the terms of a query are limited by index.max_terms_count, the missing uids are matched in batches
+		for start := 0; start < len(missing); start += ownerSearchBatchSize {
+			end := start + ownerSearchBatchSize
+			if end > len(missing) {
+				end = len(missing)
+			}
+			clusterOrphans := NewBoolExpression()
+			clusterOrphans.SetLogicType(Should)
+			clusterOrphans.addExpression(NewTerms(ClusterPath, []string{cluster}))
+			clusterOrphans.addExpression(NewTerms(OwnerReferencePath, missing[start:end]))
+			orphans.addExpression(clusterOrphans)
+		}
+	}
+	if len(orphans.expressions) == 0 {
+		// no resource is orphaned, the uid never matches
+		return NewTerms(UIDPath, []string{}), nil
+	}
+	return orphans, nil
+}
+
+// getReferencedOwners pages through the owner uids referenced by the resources with a composite aggregation,
+// grouped by cluster
+func (s *ResourceStorage) getReferencedOwners(ctx context.Context, opts *internal.ListOptions) (map[string]sets.String, error) {
+	owners := make(map[string]sets.String)
+	var after map[string]interface{}
+	for {
+		builder := NewQueryBuilder()
+		builder.size = 0
+		builder.addExpression(NewTerms(GroupPath, []string{s.storageGroupResource.Group}))
+		builder.addExpression(NewTerms(ResourcePath, []string{s.storageGroupResource.Resource}))
+		if len(opts.ClusterNames) > 0 {
+			builder.addExpression(NewTerms(ClusterPath, opts.ClusterNames))
+		}
+		if len(opts.Namespaces) > 0 {
+			builder.addExpression(NewTerms(NameSpacePath, opts.Namespaces))
+		}
+		builder.addExpression(newNotDeletedExpression())
+		composite := map[string]interface{}{
+			"size": orphanOwnersPageSize,
+			"sources": []map[string]interface{}{
+				{"cluster": map[string]interface{}{"terms": map[string]interface{}{"field": ClusterPath}}},
+				{"owner": map[string]interface{}{"terms": map[string]interface{}{"field": OwnerReferencePath}}},
+			},
+		}
+		if after != nil {
+			composite["after"] = after
+		}
+		builder.addAggregation(orphanOwnersAggregation, map[string]interface{}{"composite": composite})
+
+		r, err := s.index.Search(ctx, builder.build(), []string{s.indexName})
+		if err != nil {
+			return nil, err
+		}
+		agg, err := r.GetCompositeAggregation(orphanOwnersAggregation)
+		if err != nil {
+			return nil, err
+		}
+		if agg == nil {
+			return owners, nil
+		}
+		for _, bucket := range agg.Buckets {
+			cluster, _ := bucket.Key["cluster"].(string)
+			owner, _ := bucket.Key["owner"].(string)
+			if owners[cluster] == nil {
+				owners[cluster] = sets.NewString()
+			}
+			owners[cluster].Insert(owner)
+		}
+		if len(agg.Buckets) < orphanOwnersPageSize || agg.AfterKey == nil {
+			return owners, nil
+		}
+		after = agg.AfterKey
+	}
+}
+
+// getMissingUIDs returns the uids that are not stored in the cluster, they are looked up in batches
+func (s *ResourceStorage) getMissingUIDs(ctx context.Context, cluster string, uids []string) ([]string, error) {
+	var missing []string
+	for start := 0; start < len(uids); start += orphanOwnersPageSize {
+		end := start + orphanOwnersPageSize
+		if end > len(uids) {
+			end = len(uids)
+		}
+		batch := uids[start:end]
+
+		builder := NewQueryBuilder()
+		builder.size = len(batch)
+		builder.source = []string{UIDPath}
+		builder.addExpression(NewTerms(ClusterPath, []string{cluster}))
+		builder.addExpression(NewTerms(UIDPath, batch))
+		builder.addExpression(newNotDeletedExpression())
+		r, err := s.index.Search(ctx, builder.build(), s.resourceIndices)
+		if err != nil {
+			return nil, err
+		}
+
+		existing := sets.NewString()
+		for _, resource := range r.GetResources() {
+			if uid, ok := simpleMapExtract("metadata.uid", resource.GetObject()).(string); ok {
+				existing.Insert(uid)
+			}
+		}
+		for _, uid := range batch {
+			if !existing.Has(uid) {
+				missing = append(missing, uid)
+			}
+		}
+	}
+	return missing, nil
+}
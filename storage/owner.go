@@ -0,0 +1,306 @@
+package esstorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	internal "github.com/clusterpedia-io/api/clusterpedia"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ownerSearchPageSize  = 1000
+	ownerSearchKeepAlive = "1m"
+
+	// ownerSearchBatchSize is the number of owner uids in a terms query
+	ownerSearchBatchSize = 10000
+
+	// maxOwnerUIDs is the default index.max_terms_count, more uids can not be used to filter the resources
+	maxOwnerUIDs = 65536
+
+	// maxOwnerChainLength stops following the ownerReferences of objects that own each other
+	maxOwnerChainLength = 10
+
+	// URLQueryOwnerChain lists the object of the single name and cluster with its owners, from the direct owner
+	// to the top-level controller, as a JSON list of the owner objects in the OwnerChainAnnotation
+	URLQueryOwnerChain = "ownerChain"
+
+	OwnerChainAnnotation = "esstorage.clusterpedia.io/owner-chain"
+)
+
+// ownerChildResources are the likely child resources of the built-in workloads,
+// the children of other resources are searched in every resource
+var ownerChildResources = map[schema.GroupResource][]schema.GroupResource{
+	{Group: "apps", Resource: "deployments"}:  {{Group: "apps", Resource: "replicasets"}},
+	{Group: "apps", Resource: "replicasets"}:  {{Resource: "pods"}},
+	{Group: "apps", Resource: "daemonsets"}:   {{Resource: "pods"}, {Group: "apps", Resource: "controllerrevisions"}},
+	{Group: "apps", Resource: "statefulsets"}: {{Resource: "pods"}, {Group: "apps", Resource: "controllerrevisions"}},
+	{Group: "batch", Resource: "jobs"}:        {{Resource: "pods"}},
+	{Group: "batch", Resource: "cronjobs"}:    {{Group: "batch", Resource: "jobs"}},
+}
+
+type ownerNode struct {
+	uid string
+	gr  schema.GroupResource
+}
+
+func newOwnerNodes(uids []string) []ownerNode {
+	nodes := make([]ownerNode, 0, len(uids))
+	for _, uid := range uids {
+		nodes = append(nodes, ownerNode{uid: uid})
+	}
+	return nodes
+}
+
+func ownerUIDs(nodes []ownerNode) []string {
+	uids := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		uids = append(uids, node.uid)
+	}
+	return uids
+}
+
+// childResourcesOf returns the likely child resources of the owners, nil means any resource
+func childResourcesOf(owners []ownerNode) []schema.GroupResource {
+	var result []schema.GroupResource
+	seen := make(map[schema.GroupResource]struct{})
+	for _, owner := range owners {
+		children, ok := ownerChildResources[owner.gr]
+		if !ok {
+			return nil
+		}
+		for _, child := range children {
+			if _, ok := seen[child]; !ok {
+				seen[child] = struct{}{}
+				result = append(result, child)
+			}
+		}
+	}
+	return result
+}
+
+// getDescendants returns the descendants of the owners at the seniority level
+func (s *ResourceStorage) getDescendants(ctx context.Context, cluster string, owners []ownerNode, seniority int) ([]ownerNode, error) {
+	for ; seniority > 0 && len(owners) != 0; seniority-- {
+		children, err := s.searchChildren(ctx, cluster, owners, maxOwnerUIDs)
+		if err != nil {
+			return nil, err
+		}
+		owners = children
+	}
+	return owners, nil
+}
+
+// searchChildren pages through all the objects owned by the owners,
+// it returns an *OwnerLimitError if there are more than limit children
+func (s *ResourceStorage) searchChildren(ctx context.Context, cluster string, owners []ownerNode, limit int) ([]ownerNode, error) {
+	resources := childResourcesOf(owners)
+	var queries [][]Expression
+	for start := 0; start < len(owners); start += ownerSearchBatchSize {
+		end := start + ownerSearchBatchSize
+		if end > len(owners) {
+			end = len(owners)
+		}
+		query := []Expression{NewTerms(OwnerReferencePath, ownerUIDs(owners[start:end]))}
+		if len(resources) != 0 {
+			query = append(query, newGroupResourcesExpression(resources))
+		}
+		queries = append(queries, query)
+	}
+	return s.searchOwnerNodes(ctx, cluster, queries, limit)
+}
+
+// searchOwnerNodes pages through the objects of the cluster matched by each query with a point in time,
+// it returns an *OwnerLimitError if there are more than limit objects
+func (s *ResourceStorage) searchOwnerNodes(ctx context.Context, cluster string, queries [][]Expression, limit int) ([]ownerNode, error) {
+	if len(queries) == 0 {
+		return nil, nil
+	}
+	pitId, err := s.index.OpenPointInTime(ctx, s.resourceIndices, ownerSearchKeepAlive)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := s.index.ClosePointInTime(context.Background(), pitId); err != nil {
+			klog.ErrorS(err, "Failed to close the point in time of the owner search", "cluster", cluster)
+		}
+	}()
+
+	var nodes []ownerNode
+	for _, query := range queries {
+		var searchAfter []interface{}
+		for {
+			builder := NewQueryBuilder()
+			builder.size = ownerSearchPageSize
+			builder.source = []string{UIDPath, GroupPath, ResourcePath}
+			builder.sort = []map[string]interface{}{{"_shard_doc": "asc"}}
+			builder.setPointInTime(pitId, ownerSearchKeepAlive)
+			builder.searchAfter = searchAfter
+			for _, expression := range query {
+				builder.addExpression(expression)
+			}
+			builder.addExpression(NewTerms(ClusterPath, []string{cluster}))
+			builder.addExpression(newNotDeletedExpression())
+
+			r, err := s.index.Search(ctx, builder.build(), nil)
+			if err != nil {
+				return nil, err
+			}
+			if r.PitId != "" {
+				pitId = r.PitId
+			}
+
+			hits := r.Hits.Hits
+			for _, hit := range hits {
+				result := simpleMapExtract("metadata.uid", hit.Source.GetObject())
+				uid, ok := result.(string)
+				if !ok {
+					return nil, fmt.Errorf("extract uid failure, targetObject is %v", hit.Source.GetObject())
+				}
+				nodes = append(nodes, ownerNode{
+					uid: uid,
+					gr:  schema.GroupResource{Group: hit.Source.GetGroup(), Resource: hit.Source.GetResource()},
+				})
+			}
+			if len(nodes) > limit {
+				return nil, &OwnerLimitError{Cluster: cluster, Limit: limit}
+			}
+			if len(hits) < ownerSearchPageSize {
+				break
+			}
+			searchAfter = hits[len(hits)-1].Sort
+		}
+	}
+	return nodes, nil
+}
+
+// GetOwnerChain follows the ownerReferences of the object upward across all the resources,
+// it returns the owners from the direct owner to the top-level controller, such as the ReplicaSet
+// and the Deployment of a pod. The controller reference is followed if the object has several owners,
+// and the chain stops at the first owner that is not stored
+func (s *StorageFactory) GetOwnerChain(ctx context.Context, cluster, namespace, name string, gr schema.GroupResource) ([]*unstructured.Unstructured, error) {
+	builder := NewQueryBuilder()
+	builder.size = 1
+	builder.addExpression(NewTerms(ClusterPath, []string{cluster}))
+	builder.addExpression(NewTerms(GroupPath, []string{gr.Group}))
+	builder.addExpression(NewTerms(ResourcePath, []string{gr.Resource}))
+	builder.addExpression(NewTerms(NamePath, []string{name}))
+	if namespace != "" {
+		builder.addExpression(NewTerms(NameSpacePath, []string{namespace}))
+	}
+	builder.addExpression(newNotDeletedExpression())
+	r, err := s.index.Search(ctx, builder.build(), s.resourceIndices())
+	if err != nil {
+		return nil, err
+	}
+	resources := r.GetResources()
+	if len(resources) == 0 {
+		return nil, apierrors.NewNotFound(gr, name)
+	}
+	return getOwnerChain(ctx, s.index, s.resourceIndices(), cluster, resources[0].GetObject())
+}
+
+// getOwnerChain returns the owners of the object in the cluster from its direct owner to the top-level controller
+func getOwnerChain(ctx context.Context, index *Index, indices []string, cluster string, object map[string]interface{}) ([]*unstructured.Unstructured, error) {
+	var chain []*unstructured.Unstructured
+	seen := map[string]struct{}{}
+	for len(chain) < maxOwnerChainLength {
+		uid := ownerUIDOf(object)
+		if uid == "" {
+			break
+		}
+		if _, ok := seen[uid]; ok {
+			break
+		}
+		seen[uid] = struct{}{}
+
+		builder := NewQueryBuilder()
+		builder.size = 1
+		builder.addExpression(NewTerms(ClusterPath, []string{cluster}))
+		builder.addExpression(NewTerms(UIDPath, []string{uid}))
+		builder.addExpression(newNotDeletedExpression())
+		r, err := index.Search(ctx, builder.build(), indices)
+		if err != nil {
+			return nil, err
+		}
+		resources := r.GetResources()
+		if len(resources) == 0 {
+			break
+		}
+		owner := resources[0]
+		object = owner.GetObject()
+
+		uObj := &unstructured.Unstructured{Object: runtime.DeepCopyJSON(object)}
+		uObj.SetGroupVersionKind(schema.GroupVersionKind{Group: owner.GetGroup(), Version: owner.GetVersion(), Kind: owner.GetKind()})
+		chain = append(chain, uObj)
+	}
+	return chain, nil
+}
+
+// parseOwnerChainQuery returns whether the owner chain of the listed object is requested
+func parseOwnerChainQuery(opts *internal.ListOptions) (bool, error) {
+	if !opts.URLQuery.Has(URLQueryOwnerChain) {
+		return false, nil
+	}
+	ownerChain, err := strconv.ParseBool(opts.URLQuery.Get(URLQueryOwnerChain))
+	if err != nil {
+		return false, apierrors.NewBadRequest(fmt.Sprintf("invalid %s: %v", URLQueryOwnerChain, err))
+	}
+	if ownerChain && (len(opts.Names) != 1 || len(opts.ClusterNames) != 1 || len(opts.Namespaces) > 1) {
+		return false, apierrors.NewBadRequest(fmt.Sprintf("%s requires a single name, a single cluster and at most one namespace", URLQueryOwnerChain))
+	}
+	return ownerChain, nil
+}
+
+// setOwnerChainAnnotation records the owners of the listed object in the OwnerChainAnnotation
+func (s *ResourceStorage) setOwnerChainAnnotation(ctx context.Context, obj runtime.Object, resource *Resource) error {
+	chain, err := getOwnerChain(ctx, s.index, s.resourceIndices, getClusterName(resource.GetObject()), resource.GetObject())
+	if err != nil {
+		return err
+	}
+	if chain == nil {
+		chain = []*unstructured.Unstructured{}
+	}
+	value, err := json.Marshal(chain)
+	if err != nil {
+		return err
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	annotations := accessor.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[OwnerChainAnnotation] = string(value)
+	accessor.SetAnnotations(annotations)
+	return nil
+}
+
+// ownerUIDOf returns the uid of the controller reference of the object, or the first owner if there is no controller
+func ownerUIDOf(object map[string]interface{}) string {
+	refs, _ := simpleMapExtract("metadata.ownerReferences", object).([]interface{})
+	var first string
+	for _, item := range refs {
+		ref, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		uid, _ := ref["uid"].(string)
+		if controller, _ := ref["controller"].(bool); controller {
+			return uid
+		}
+		if first == "" {
+			first = uid
+		}
+	}
+	return first
+}
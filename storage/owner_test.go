@@ -0,0 +1,43 @@
+package esstorage
+
+import (
+	"net/url"
+	"testing"
+
+	internal "github.com/clusterpedia-io/api/clusterpedia"
+)
+
+func TestOwnerUIDOf(t *testing.T) {
+	object := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"ownerReferences": []interface{}{
+				map[string]interface{}{"uid": "first"},
+				map[string]interface{}{"uid": "controller", "controller": true},
+			},
+		},
+	}
+	if uid := ownerUIDOf(object); uid != "controller" {
+		t.Errorf("ownerUIDOf() = %q, want the controller", uid)
+	}
+	if uid := ownerUIDOf(map[string]interface{}{}); uid != "" {
+		t.Errorf("ownerUIDOf() of an object without owners = %q", uid)
+	}
+}
+
+func TestParseOwnerChainQuery(t *testing.T) {
+	urlQuery := url.Values{URLQueryOwnerChain: {"true"}}
+	opts := &internal.ListOptions{Names: []string{"nginx-7d9c"}, ClusterNames: []string{"c1"}, URLQuery: urlQuery}
+	if ownerChain, err := parseOwnerChainQuery(opts); err != nil || !ownerChain {
+		t.Errorf("parseOwnerChainQuery() = %v, %v", ownerChain, err)
+	}
+
+	for _, opts := range []*internal.ListOptions{
+		{ClusterNames: []string{"c1"}, URLQuery: urlQuery},
+		{Names: []string{"nginx-7d9c"}, ClusterNames: []string{"c1", "c2"}, URLQuery: urlQuery},
+		{Names: []string{"nginx-7d9c"}, ClusterNames: []string{"c1"}, URLQuery: url.Values{URLQueryOwnerChain: {"yes"}}},
+	} {
+		if _, err := parseOwnerChainQuery(opts); err == nil {
+			t.Errorf("parseOwnerChainQuery(%+v) should fail", opts)
+		}
+	}
+}
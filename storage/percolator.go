@@ -0,0 +1,360 @@
+package esstorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	internal "github.com/clusterpedia-io/api/clusterpedia"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+const (
+	percolatorIndex = "clusterpedia-percolator"
+
+	PercolatorQueryPath    = "query"
+	PercolatorNamePath     = "search.name"
+	PercolatorGroupPath    = "search.group"
+	PercolatorResourcePath = "search.resource"
+
+	maxPercolatorMatches = 1000
+
+	// percolatorQueueSize bounds the writes waiting to be percolated, the writes are dropped when it is full
+	percolatorQueueSize = 10000
+	percolatorTimeout   = 30 * time.Second
+
+	MatchStarted = "started"
+	MatchStopped = "stopped"
+)
+
+// PercolatorConfig evaluates the registered match queries against every written object,
+// the objects which start or stop matching a query are sent to the sinks asynchronously after they are stored
+type PercolatorConfig struct {
+	Enabled bool              `yaml:"enabled"`
+	Sinks   []MatchSinkConfig `yaml:"sinks"`
+}
+
+// MatchEvent is sent when an object starts or stops matching a registered query
+type MatchEvent struct {
+	Query           string    `json:"query"`
+	Match           string    `json:"match"`
+	Cluster         string    `json:"cluster"`
+	Group           string    `json:"group"`
+	Version         string    `json:"version"`
+	Resource        string    `json:"resource"`
+	Namespace       string    `json:"namespace,omitempty"`
+	Name            string    `json:"name"`
+	UID             string    `json:"uid"`
+	ResourceVersion string    `json:"resourceVersion"`
+	Time            time.Time `json:"time"`
+}
+
+type percolator struct {
+	index *Index
+	queue chan *percolation
+
+	lock  sync.RWMutex
+	sinks []MatchSink
+	// queries are the names of the registered queries by resource
+	queries map[schema.GroupResource]sets.String
+}
+
+// percolation is a write of an object, which is compared with the previous document
+type percolation struct {
+	gr                   schema.GroupResource
+	version              string
+	cluster              string
+	uid, resourceVersion string
+	previous, current    map[string]interface{}
+}
+
+func newPercolator(index *Index, config *PercolatorConfig) (*percolator, error) {
+	p := &percolator{
+		index:   index,
+		queue:   make(chan *percolation, percolatorQueueSize),
+		queries: make(map[schema.GroupResource]sets.String),
+	}
+	for i := range config.Sinks {
+		sink, err := newMatchSink(&config.Sinks[i])
+		if err != nil {
+			return nil, fmt.Errorf("percolator sink %d: %w", i, err)
+		}
+		p.sinks = append(p.sinks, sink)
+	}
+	mapping, err := percolatorMapping()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureIndex(index.client, mapping, percolatorIndex); err != nil {
+		return nil, err
+	}
+	if err := p.loadQueries(context.Background()); err != nil {
+		return nil, err
+	}
+	go p.run()
+	return p, nil
+}
+
+// percolatorMapping maps the document fields like the resource indices, so that the queries can be parsed
+func percolatorMapping() (string, error) {
+	indexMapping, err := GetIndexMapping(percolatorIndex+"-queries", schema.GroupResource{}, nil)
+	if err != nil {
+		return "", err
+	}
+	var mapping map[string]interface{}
+	if err := json.Unmarshal([]byte(indexMapping), &mapping); err != nil {
+		return "", err
+	}
+	delete(mapping, "aliases")
+	settings, ok := mapping["settings"].(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("the index mapping has no settings")
+	}
+	properties, ok := simpleMapExtract("mappings.properties", mapping).(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("the index mapping has no properties")
+	}
+	// the fields of the queries which are not mapped, such as the extracted fields, are parsed as text
+	settings["index.percolator.map_unmapped_fields_as_text"] = true
+	properties[PercolatorQueryPath] = map[string]interface{}{"type": "percolator"}
+	properties["search"] = map[string]interface{}{
+		"properties": map[string]interface{}{
+			"name":     map[string]interface{}{"type": "keyword"},
+			"group":    map[string]interface{}{"type": "keyword"},
+			"resource": map[string]interface{}{"type": "keyword"},
+		},
+	}
+	data, err := json.Marshal(mapping)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// loadQueries loads the names of the registered queries, so that the resources without queries are not percolated
+func (p *percolator) loadQueries(ctx context.Context) error {
+	builder := NewQueryBuilder()
+	builder.source = []string{PercolatorNamePath, PercolatorGroupPath, PercolatorResourcePath}
+	sources, err := searchAllSources(ctx, p.index, builder, PercolatorNamePath, []string{percolatorIndex})
+	if err != nil {
+		return err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, source := range sources {
+		name, _ := simpleMapExtract(PercolatorNamePath, source).(string)
+		group, _ := simpleMapExtract(PercolatorGroupPath, source).(string)
+		resource, _ := simpleMapExtract(PercolatorResourcePath, source).(string)
+		p.addQuery(name, schema.GroupResource{Group: group, Resource: resource})
+	}
+	return nil
+}
+
+// addQuery records the query of the resource, the lock must be held
+func (p *percolator) addQuery(name string, gr schema.GroupResource) {
+	for _, names := range p.queries {
+		names.Delete(name)
+	}
+	if p.queries[gr] == nil {
+		p.queries[gr] = sets.NewString()
+	}
+	p.queries[gr].Insert(name)
+}
+
+func (p *percolator) hasQueries(gr schema.GroupResource) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.queries[gr].Len() != 0
+}
+
+// AddMatchSink adds a sink of the match events of the registered queries
+func (s *StorageFactory) AddMatchSink(sink MatchSink) error {
+	if s.percolator == nil {
+		return fmt.Errorf("percolator is not enabled")
+	}
+	s.percolator.lock.Lock()
+	defer s.percolator.lock.Unlock()
+	s.percolator.sinks = append(s.percolator.sinks, sink)
+	return nil
+}
+
+// RegisterMatchQuery stores the list options of the resource as a percolator query, the owner options are
+// not supported because they are not evaluated on a single document, and the full text `query` matches
+// only the resources whose full text search is enabled
+func (s *StorageFactory) RegisterMatchQuery(ctx context.Context, name string, gr schema.GroupResource, opts *internal.ListOptions) error {
+	if s.percolator == nil {
+		return fmt.Errorf("percolator is not enabled")
+	}
+	if opts.OwnerUID != "" || opts.OwnerName != "" {
+		return apierrors.NewBadRequest("owner options are not supported by match queries")
+	}
+
+	builder := NewQueryBuilder()
+	if err := applyListOptionToQueryBuilder(ctx, &savedSearchExpander{index: s.index, gr: gr}, builder, opts); err != nil {
+		return err
+	}
+	err := s.index.Upsert(ctx, percolatorIndex, name, map[string]interface{}{
+		PercolatorQueryPath: builder.boolExp.ToMap(),
+		"search": map[string]interface{}{
+			"name":     name,
+			"group":    gr.Group,
+			"resource": gr.Resource,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	s.percolator.lock.Lock()
+	defer s.percolator.lock.Unlock()
+	s.percolator.addQuery(name, gr)
+	return nil
+}
+
+func (s *StorageFactory) DeleteMatchQuery(ctx context.Context, name string) error {
+	if s.percolator == nil {
+		return fmt.Errorf("percolator is not enabled")
+	}
+	if err := s.index.DeleteById(ctx, name, percolatorIndex); err != nil {
+		return err
+	}
+	s.percolator.lock.Lock()
+	defer s.percolator.lock.Unlock()
+	for _, names := range s.percolator.queries {
+		names.Delete(name)
+	}
+	return nil
+}
+
+// match returns the names of the queries of the resource which match the document
+func (p *percolator) match(ctx context.Context, gr schema.GroupResource, doc map[string]interface{}) (sets.String, error) {
+	names := sets.NewString()
+	if doc == nil {
+		return names, nil
+	}
+	// the custom fields are excluded from the stored source, only the full text object is percolated,
+	// because it is rebuilt for the previous document
+	document := make(map[string]interface{}, len(doc))
+	for key, value := range doc {
+		if key != "custom" {
+			document[key] = value
+		}
+	}
+	if fullText := simpleMapExtract(FullTextObjectPath, doc); fullText != nil {
+		document["custom"] = map[string]interface{}{"fullTextObject": fullText}
+	}
+
+	builder := NewQueryBuilder()
+	builder.size = maxPercolatorMatches
+	builder.source = []string{PercolatorNamePath}
+	builder.addExpression(NewPercolate(PercolatorQueryPath, document))
+	builder.addExpression(NewTerms(PercolatorGroupPath, []string{gr.Group}))
+	builder.addExpression(NewTerms(PercolatorResourcePath, []string{gr.Resource}))
+	r, err := p.index.Search(ctx, builder.build(), []string{percolatorIndex})
+	if err != nil {
+		return nil, err
+	}
+	for _, hit := range r.Hits.Hits {
+		names.Insert(hit.Id)
+	}
+	return names, nil
+}
+
+// percolate queues the write of the object to be compared with the previous document,
+// it never blocks the write, the write is dropped if the queue is full
+func (s *ResourceStorage) percolate(cluster string, previous, current map[string]interface{}, uid, resourceVersion string) {
+	if s.percolator == nil || !s.percolator.hasQueries(s.storageGroupResource) {
+		return
+	}
+	if s.fullTextSearch && previous != nil {
+		// the full text object is the stored object, which is excluded from the stored source
+		if value, err := json.Marshal(previous["object"]); err == nil {
+			previous["custom"] = map[string]interface{}{"fullTextObject": string(value)}
+		}
+	}
+	write := &percolation{
+		gr:              s.storageGroupResource,
+		version:         s.storageVersion.Version,
+		cluster:         cluster,
+		uid:             uid,
+		resourceVersion: resourceVersion,
+		previous:        previous,
+		current:         current,
+	}
+	select {
+	case s.percolator.queue <- write:
+	default:
+		klog.ErrorS(nil, "Failed to percolate the object, the percolator queue is full", "cluster", cluster, "uid", uid)
+	}
+}
+
+// run percolates the queued writes in order
+func (p *percolator) run() {
+	for write := range p.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), percolatorTimeout)
+		p.percolate(ctx, write)
+		cancel()
+	}
+}
+
+// percolate sends the match events of the queries which the object starts or stops matching,
+// errors are logged because the object is already stored
+func (p *percolator) percolate(ctx context.Context, write *percolation) {
+	previousMatches, err := p.match(ctx, write.gr, write.previous)
+	if err != nil {
+		klog.ErrorS(err, "Failed to percolate the previous document", "cluster", write.cluster, "uid", write.uid)
+		return
+	}
+	currentMatches, err := p.match(ctx, write.gr, write.current)
+	if err != nil {
+		klog.ErrorS(err, "Failed to percolate the document", "cluster", write.cluster, "uid", write.uid)
+		return
+	}
+
+	doc := write.current
+	if doc == nil {
+		doc = write.previous
+	}
+	newEvent := func(query, match string) *MatchEvent {
+		event := &MatchEvent{
+			Query:           query,
+			Match:           match,
+			Cluster:         write.cluster,
+			Group:           write.gr.Group,
+			Version:         write.version,
+			Resource:        write.gr.Resource,
+			UID:             write.uid,
+			ResourceVersion: write.resourceVersion,
+			Time:            time.Now(),
+		}
+		event.Namespace, _ = doc["namespace"].(string)
+		event.Name, _ = doc["name"].(string)
+		return event
+	}
+
+	var events []*MatchEvent
+	for _, query := range currentMatches.Difference(previousMatches).List() {
+		events = append(events, newEvent(query, MatchStarted))
+	}
+	for _, query := range previousMatches.Difference(currentMatches).List() {
+		events = append(events, newEvent(query, MatchStopped))
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	p.lock.RLock()
+	sinks := p.sinks
+	p.lock.RUnlock()
+	for _, event := range events {
+		for _, sink := range sinks {
+			if err := sink.Send(ctx, event); err != nil {
+				klog.ErrorS(err, "Failed to send the match event", "query", event.Query, "cluster", write.cluster, "uid", write.uid)
+			}
+		}
+	}
+}
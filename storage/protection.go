@@ -0,0 +1,297 @@
+package esstorage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type ProtectionMode string
+
+const (
+	// ProtectionModeDrop removes the protected fields from the stored object
+	ProtectionModeDrop ProtectionMode = "drop"
+	// ProtectionModeHash replaces every protected value with its HMAC-SHA256 keyed by the primary key,
+	// equal values have equal hashes only while they are hashed with the same key
+	ProtectionModeHash ProtectionMode = "hash"
+	// ProtectionModeEncrypt encrypts every protected value with AES-GCM
+	ProtectionModeEncrypt ProtectionMode = "encrypt"
+)
+
+const (
+	hashedValuePrefix    = "hmac-sha256:"
+	encryptedValuePrefix = "enc:v1:"
+)
+
+// DataProtectionConfig configures how the sensitive fields of a resource are stored
+type DataProtectionConfig struct {
+	// Resource is written as `resource.group`, for example `secrets`
+	Resource string         `yaml:"resource"`
+	Mode     ProtectionMode `yaml:"mode"`
+
+	// Paths are dot separated paths to maps whose values are protected,
+	// values under Base64Paths are base64 encoded, like the `data` of secrets.
+	// secrets default to `stringData` and base64 encoded `data`
+	Paths       []string `yaml:"paths"`
+	Base64Paths []string `yaml:"base64Paths"`
+
+	// KeyFile contains one `name:base64-key` per line, it is required by the encrypt and hash modes.
+	// The first key encrypts and hashes new values and all keys decrypt, so a key is rotated by prepending
+	// the new key. The stored hashes are not rehashed, an object keeps the hashes of the old key until it is
+	// written again, so the hashes of the same value differ across a rotation
+	KeyFile string `yaml:"keyFile"`
+	// Decrypt allows Get and List to return the decrypted values
+	Decrypt bool `yaml:"decrypt"`
+}
+
+type dataProtector struct {
+	mode        ProtectionMode
+	paths       []string
+	base64Paths []string
+
+	decrypt bool
+	keyring *keyring
+}
+
+func newDataProtectors(configs []DataProtectionConfig) (map[schema.GroupResource]*dataProtector, error) {
+	protectors := make(map[schema.GroupResource]*dataProtector, len(configs))
+	for i := range configs {
+		config := configs[i]
+		gr := schema.ParseGroupResource(config.Resource)
+		if _, ok := protectors[gr]; ok {
+			return nil, fmt.Errorf("data protection: duplicate resource %s", gr)
+		}
+		protector, err := newDataProtector(gr, &config)
+		if err != nil {
+			return nil, fmt.Errorf("data protection %s: %w", gr, err)
+		}
+		protectors[gr] = protector
+	}
+	return protectors, nil
+}
+
+func newDataProtector(gr schema.GroupResource, config *DataProtectionConfig) (*dataProtector, error) {
+	protector := &dataProtector{
+		mode:        config.Mode,
+		paths:       config.Paths,
+		base64Paths: config.Base64Paths,
+		decrypt:     config.Decrypt,
+	}
+	if len(protector.paths) == 0 && len(protector.base64Paths) == 0 && gr.Group == "" && gr.Resource == ResourceSecret {
+		protector.paths = []string{"stringData"}
+		protector.base64Paths = []string{"data"}
+	}
+
+	switch config.Mode {
+	case ProtectionModeDrop:
+	case ProtectionModeHash, ProtectionModeEncrypt:
+		keyring, err := loadKeyring(config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		protector.keyring = keyring
+	default:
+		return nil, fmt.Errorf("unknown mode %q", config.Mode)
+	}
+	return protector, nil
+}
+
+// protect replaces the protected values of the object in place
+func (p *dataProtector) protect(object map[string]interface{}) error {
+	if p.mode == ProtectionModeDrop {
+		for _, paths := range [][]string{p.paths, p.base64Paths} {
+			for _, path := range paths {
+				removeMapField(path, object)
+			}
+		}
+		return nil
+	}
+
+	protect := func(value string) (string, error) {
+		if p.mode == ProtectionModeHash {
+			return p.keyring.hash(value), nil
+		}
+		return p.keyring.encrypt(value)
+	}
+	if err := mutateMapValues(p.paths, object, protect); err != nil {
+		return err
+	}
+	return mutateMapValues(p.base64Paths, object, func(value string) (string, error) {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return "", err
+		}
+		protected, err := protect(string(decoded))
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString([]byte(protected)), nil
+	})
+}
+
+// reveal decrypts the protected values of the object in place when decryption is allowed
+func (p *dataProtector) reveal(object map[string]interface{}) error {
+	if p.mode != ProtectionModeEncrypt || !p.decrypt {
+		return nil
+	}
+	if err := mutateMapValues(p.paths, object, p.keyring.decrypt); err != nil {
+		return err
+	}
+	return mutateMapValues(p.base64Paths, object, func(value string) (string, error) {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return "", err
+		}
+		revealed, err := p.keyring.decrypt(string(decoded))
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString([]byte(revealed)), nil
+	})
+}
+
+func mutateMapValues(paths []string, object map[string]interface{}, mutate func(string) (string, error)) error {
+	for _, path := range paths {
+		values, ok := simpleMapExtract(path, object).(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for key, value := range values {
+			str, ok := value.(string)
+			if !ok {
+				continue
+			}
+			mutated, err := mutate(str)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", path, key, err)
+			}
+			values[key] = mutated
+		}
+	}
+	return nil
+}
+
+func removeMapField(path string, object map[string]interface{}) {
+	index := strings.LastIndex(path, ".")
+	if index == -1 {
+		delete(object, path)
+		return
+	}
+	if parent, ok := simpleMapExtract(path[:index], object).(map[string]interface{}); ok {
+		delete(parent, path[index+1:])
+	}
+}
+
+type keyring struct {
+	primary string
+	keys    map[string][]byte
+	aeads   map[string]cipher.AEAD
+}
+
+func loadKeyring(path string) (*keyring, error) {
+	if path == "" {
+		return nil, fmt.Errorf("keyFile is required by the encrypt and hash modes")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	keyring := &keyring{keys: make(map[string][]byte), aeads: make(map[string]cipher.AEAD)}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, encoded, ok := strings.Cut(line, ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid key line in %s, expected `name:base64-key`", path)
+		}
+		if _, ok := keyring.aeads[name]; ok {
+			return nil, fmt.Errorf("duplicate key %s in %s", name, path)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", name, err)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", name, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", name, err)
+		}
+		if keyring.primary == "" {
+			keyring.primary = name
+		}
+		keyring.keys[name] = key
+		keyring.aeads[name] = aead
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if keyring.primary == "" {
+		return nil, fmt.Errorf("no key in %s", path)
+	}
+	return keyring, nil
+}
+
+// hash returns the HMAC-SHA256 of the value keyed by the primary key, the result is `hmac-sha256:<key name>:<hex>`
+func (k *keyring) hash(value string) string {
+	mac := hmac.New(sha256.New, k.keys[k.primary])
+	mac.Write([]byte(value))
+	return hashedValuePrefix + k.primary + ":" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// encrypt seals the value with the primary key, the result is `enc:v1:<key name>:<base64(nonce|ciphertext)>`
+func (k *keyring) encrypt(value string) (string, error) {
+	aead := k.aeads[k.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(k.primary))
+	return encryptedValuePrefix + k.primary + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt opens a value sealed by encrypt, values that are not encrypted are returned as is
+func (k *keyring) decrypt(value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedValuePrefix) {
+		return value, nil
+	}
+	name, encoded, ok := strings.Cut(strings.TrimPrefix(value, encryptedValuePrefix), ":")
+	if !ok {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	aead, ok := k.aeads[name]
+	if !ok {
+		return "", fmt.Errorf("unknown key %s", name)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
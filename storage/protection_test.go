@@ -0,0 +1,136 @@
+package esstorage
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func testKey(b byte, size int) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), size)))
+}
+
+func writeKeyFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadKeyring(t *testing.T) {
+	keyring, err := loadKeyring(writeKeyFile(t, "# rotated\nnew:"+testKey('b', 16)+"\n\nold:"+testKey('a', 32)+"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyring.primary != "new" || len(keyring.aeads) != 2 {
+		t.Errorf("loadKeyring() primary = %q with %d keys, want new with 2 keys", keyring.primary, len(keyring.aeads))
+	}
+
+	for _, content := range []string{
+		"# empty\n",
+		testKey('a', 32),
+		"k:" + testKey('a', 32) + "\nk:" + testKey('b', 32),
+		"k:" + testKey('a', 10),
+	} {
+		if _, err := loadKeyring(writeKeyFile(t, content)); err == nil {
+			t.Errorf("loadKeyring(%q) should fail", content)
+		}
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	oldKeyring, err := loadKeyring(writeKeyFile(t, "old:"+testKey('a', 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := loadKeyring(writeKeyFile(t, "new:"+testKey('b', 32)+"\nold:"+testKey('a', 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the values encrypted by the old key are decrypted after the rotation
+	encrypted, err := oldKeyring.encrypt("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted, err := rotated.decrypt(encrypted); err != nil || decrypted != "token" {
+		t.Errorf("decrypt() = %q, %v, want token", decrypted, err)
+	}
+	if encrypted, _ := rotated.encrypt("token"); !strings.HasPrefix(encrypted, encryptedValuePrefix+"new:") {
+		t.Errorf("encrypt() = %q, want the new key", encrypted)
+	}
+
+	// the hashes depend on the primary key
+	hash := oldKeyring.hash("password")
+	if !strings.HasPrefix(hash, hashedValuePrefix+"old:") || oldKeyring.hash("password") != hash {
+		t.Errorf("hash() = %q, want a stable hash of the old key", hash)
+	}
+	if rotated.hash("password") == hash {
+		t.Error("hash() should change with the primary key")
+	}
+}
+
+func TestKeyringDecryptErrors(t *testing.T) {
+	keyring, err := loadKeyring(writeKeyFile(t, "k:"+testKey('a', 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := loadKeyring(writeKeyFile(t, "k:"+testKey('b', 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := other.encrypt("value")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := keyring.decrypt("plain"); err != nil || got != "plain" {
+		t.Errorf("decrypt() of a plain value = %q, %v", got, err)
+	}
+	for _, value := range []string{encryptedValuePrefix + "missing:" + testKey('a', 32), encrypted} {
+		if _, err := keyring.decrypt(value); err == nil {
+			t.Errorf("decrypt(%q) should fail", value)
+		}
+	}
+}
+
+func TestProtectSecret(t *testing.T) {
+	protector, err := newDataProtector(schema.GroupResource{Resource: ResourceSecret}, &DataProtectionConfig{
+		Mode:    ProtectionModeEncrypt,
+		KeyFile: writeKeyFile(t, "k:"+testKey('a', 32)),
+		Decrypt: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	password := base64.StdEncoding.EncodeToString([]byte("password"))
+	object := map[string]interface{}{
+		"data":       map[string]interface{}{"password": password},
+		"stringData": map[string]interface{}{"user": "admin"},
+	}
+	if err := protector.protect(object); err != nil {
+		t.Fatal(err)
+	}
+	if data := simpleMapExtract("data.password", object); data == password {
+		t.Error("protect() should encrypt the data")
+	}
+	if user := simpleMapExtract("stringData.user", object); user == "admin" {
+		t.Error("protect() should encrypt the stringData")
+	}
+
+	if err := protector.reveal(object); err != nil {
+		t.Fatal(err)
+	}
+	if data := simpleMapExtract("data.password", object); data != password {
+		t.Errorf("reveal() data = %v, want %v", data, password)
+	}
+	if user := simpleMapExtract("stringData.user", object); user != "admin" {
+		t.Errorf("reveal() stringData = %v, want admin", user)
+	}
+}
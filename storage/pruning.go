@@ -0,0 +1,80 @@
+package esstorage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const lastAppliedConfigAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// PruningRule removes bulky fields of a resource before they are stored
+type PruningRule struct {
+	// Resource is written as `resource.group`, for example `deployments.apps`,
+	// `*` applies the rule to every resource
+	Resource string `yaml:"resource"`
+
+	ManagedFields            bool `yaml:"managedFields"`
+	LastAppliedConfiguration bool `yaml:"lastAppliedConfiguration"`
+
+	// Paths are JSONPath-like paths to the removed fields, for example `status.images`
+	Paths []string `yaml:"paths"`
+}
+
+type pruners map[string][]fieldPath
+
+func newPruners(rules []PruningRule) (pruners, error) {
+	result := make(pruners)
+	for i, rule := range rules {
+		if rule.Resource == "" {
+			return nil, fmt.Errorf("pruning rule %d: resource is required", i)
+		}
+
+		var paths []string
+		if rule.ManagedFields {
+			paths = append(paths, "metadata.managedFields")
+		}
+		if rule.LastAppliedConfiguration {
+			paths = append(paths, fmt.Sprintf("metadata.annotations['%s']", lastAppliedConfigAnnotation))
+		}
+		paths = append(paths, rule.Paths...)
+
+		resource := rule.Resource
+		if resource != anyResource {
+			resource = schema.ParseGroupResource(resource).String()
+		}
+		for _, path := range paths {
+			fieldPath, err := parseFieldPath(path)
+			if err != nil {
+				return nil, fmt.Errorf("pruning rule %d: %w", i, err)
+			}
+			result[resource] = append(result[resource], fieldPath)
+		}
+	}
+	return result, nil
+}
+
+// prunerFor returns the paths pruned from the objects of the group resource
+func (p pruners) prunerFor(gr schema.GroupResource) pruner {
+	var result pruner
+	result = append(result, p[anyResource]...)
+	result = append(result, p[gr.String()]...)
+	return result
+}
+
+type pruner []fieldPath
+
+// prune removes the fields from the object in place and returns the size of the removed JSON
+func (p pruner) prune(object map[string]interface{}) int {
+	var size int
+	for _, path := range p {
+		for _, removed := range path.remove(object) {
+			value, err := json.Marshal(removed)
+			if err == nil {
+				size += len(value)
+			}
+		}
+	}
+	return size
+}
@@ -0,0 +1,139 @@
+package esstorage
+
+import (
+	"fmt"
+	"regexp"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	defaultRedactionReplacement = "[REDACTED]"
+
+	// anyResource matches every resource in the resource rules of the config
+	anyResource = "*"
+)
+
+// RedactionRule redacts sensitive string values of a resource before they are stored
+type RedactionRule struct {
+	// Resource is written as `resource.group`, for example `pods` or `applications.argoproj.io`,
+	// `*` applies the rule to every resource
+	Resource string `yaml:"resource"`
+
+	// Paths are JSONPath-like paths to the redacted values, for example `spec.containers[*].env[*].value`,
+	// the object except its `metadata`, `apiVersion` and `kind` is searched when no path is set
+	Paths []string `yaml:"paths"`
+
+	// ValueRegexes redact only the matched parts of the values, the whole value is redacted when no regex is set
+	ValueRegexes []string `yaml:"valueRegexes"`
+
+	// Replacement defaults to `[REDACTED]`
+	Replacement string `yaml:"replacement"`
+}
+
+// unredactedFields are not searched by the rules without paths, because the storage relies on
+// the metadata, such as the names, labels and the cluster annotation, and the type of the object
+var unredactedFields = sets.NewString("apiVersion", "kind", "metadata")
+
+type redactor struct {
+	paths       []fieldPath
+	regexes     []*regexp.Regexp
+	replacement string
+}
+
+type redactors []*redactor
+
+func newRedactors(rules []RedactionRule) (map[string]redactors, error) {
+	result := make(map[string]redactors)
+	for i, rule := range rules {
+		redactor, err := newRedactor(&rule)
+		if err != nil {
+			return nil, fmt.Errorf("redaction rule %d: %w", i, err)
+		}
+		resource := rule.Resource
+		if resource != anyResource {
+			resource = schema.ParseGroupResource(resource).String()
+		}
+		result[resource] = append(result[resource], redactor)
+	}
+	return result, nil
+}
+
+func newRedactor(rule *RedactionRule) (*redactor, error) {
+	if rule.Resource == "" {
+		return nil, fmt.Errorf("resource is required")
+	}
+	if len(rule.Paths) == 0 && len(rule.ValueRegexes) == 0 {
+		return nil, fmt.Errorf("at least one of paths and valueRegexes is required")
+	}
+
+	redactor := &redactor{replacement: rule.Replacement}
+	if redactor.replacement == "" {
+		redactor.replacement = defaultRedactionReplacement
+	}
+	for _, path := range rule.Paths {
+		fieldPath, err := parseFieldPath(path)
+		if err != nil {
+			return nil, err
+		}
+		redactor.paths = append(redactor.paths, fieldPath)
+	}
+	for _, expr := range rule.ValueRegexes {
+		regex, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		redactor.regexes = append(redactor.regexes, regex)
+	}
+	return redactor, nil
+}
+
+// redactorsFor returns the redactors applied to the group resource
+func redactorsFor(all map[string]redactors, gr schema.GroupResource) redactors {
+	var result redactors
+	result = append(result, all[anyResource]...)
+	result = append(result, all[gr.String()]...)
+	return result
+}
+
+// redact replaces the sensitive values of the object in place
+func (rs redactors) redact(object map[string]interface{}) {
+	for _, r := range rs {
+		if len(r.paths) == 0 {
+			for key, value := range object {
+				if !unredactedFields.Has(key) {
+					object[key] = r.redactStrings(value)
+				}
+			}
+			continue
+		}
+		for _, path := range r.paths {
+			path.walk(object, r.redactStrings)
+		}
+	}
+}
+
+// redactStrings redacts all the string values under the value, other values are kept as is
+// so that the object can still be decoded
+func (r *redactor) redactStrings(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if len(r.regexes) == 0 {
+			return r.replacement
+		}
+		for _, regex := range r.regexes {
+			v = regex.ReplaceAllLiteralString(v, r.replacement)
+		}
+		return v
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = r.redactStrings(v[key])
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = r.redactStrings(v[i])
+		}
+	}
+	return value
+}
@@ -0,0 +1,42 @@
+package esstorage
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestRedactWithoutPaths(t *testing.T) {
+	rs, err := newRedactors([]RedactionRule{{Resource: anyResource, ValueRegexes: []string{`token-\w+`}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	object := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]interface{}{
+			"name":        "token-pod",
+			"annotations": map[string]interface{}{"note": "token-abc"},
+		},
+		"spec": map[string]interface{}{
+			"args": []interface{}{"--auth=token-abc", "--verbose"},
+		},
+	}
+	redactorsFor(rs, schema.GroupResource{Resource: "pods"}).redact(object)
+
+	want := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]interface{}{
+			"name":        "token-pod",
+			"annotations": map[string]interface{}{"note": "token-abc"},
+		},
+		"spec": map[string]interface{}{
+			"args": []interface{}{"--auth=[REDACTED]", "--verbose"},
+		},
+	}
+	if !reflect.DeepEqual(object, want) {
+		t.Errorf("redact() = %v, want %v", object, want)
+	}
+}
@@ -2,6 +2,7 @@ package esstorage
 
 import (
 	"github.com/jinzhu/configor"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 
 	"github.com/clusterpedia-io/clusterpedia/pkg/storage"
@@ -23,10 +24,68 @@ func NewStorageFactory(configPath string) (storage.StorageFactory, error) {
 		return nil, err
 	}
 
-	return &StorageFactory{
+	protectors, err := newDataProtectors(cfg.DataProtection)
+	if err != nil {
+		return nil, err
+	}
+	redactors, err := newRedactors(cfg.Redaction)
+	if err != nil {
+		return nil, err
+	}
+	pruners, err := newPruners(cfg.Pruning)
+	if err != nil {
+		return nil, err
+	}
+	extractors, err := newExtractors(cfg.Extraction)
+	if err != nil {
+		return nil, err
+	}
+	mappings, err := validateMappingOverrides(cfg.Mappings)
+	if err != nil {
+		return nil, err
+	}
+	fingerprinters, err := newFingerprinters(cfg.Fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.History.validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Tombstones.validate(); err != nil {
+		return nil, err
+	}
+
+	index := NewIndex(initESClient(cfg))
+	var percolator *percolator
+	if cfg.Percolator.Enabled {
+		if percolator, err = newPercolator(index, &cfg.Percolator); err != nil {
+			return nil, err
+		}
+	}
+
+	factory := &StorageFactory{
 		indexAlias: "clusterpedia-resource",
-		index:      NewIndex(initESClient(cfg)),
-	}, nil
+		index:      index,
+		config:     cfg,
+		protectors: protectors,
+		redactors:  redactors,
+		pruners:    pruners,
+		extractors: extractors,
+		mappings:   mappings,
+
+		fingerprinters: fingerprinters,
+		percolator:     percolator,
+
+		tombstoneIndices: sets.NewString(),
+	}
+	serveMetrics(&cfg.Metrics)
+	if len(cfg.History.Resources) > 0 {
+		go factory.purgeHistory()
+	}
+	if len(cfg.Tombstones.Resources) > 0 {
+		go factory.purgeTombstones()
+	}
+	return factory, nil
 }
 
 func initESClient(cfg *Config) *elasticsearch.Client {
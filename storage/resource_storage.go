@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/clusterpedia-io/clusterpedia/pkg/utils/feature"
 	"reflect"
 	"strconv"
 
@@ -19,13 +18,14 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/watch"
 	genericstorage "k8s.io/apiserver/pkg/storage"
+	"k8s.io/klog/v2"
 
 	internal "github.com/clusterpedia-io/api/clusterpedia"
 	"github.com/clusterpedia-io/clusterpedia/pkg/storage"
 )
 
 var (
-	supportedOrderByFields = sets.NewString("cluster", "namespace", "name", "created_at", "resource_version")
+	supportedOrderByFields = sets.NewString("cluster", "namespace", "name", "created_at", "resource_version", "score")
 )
 
 type ResourceStorage struct {
@@ -36,10 +36,23 @@ type ResourceStorage struct {
 	storageVersion       schema.GroupVersion
 	memoryVersion        schema.GroupVersion
 
-	indexName     string
-	resourceAlias string
-
-	extractConfig []string
+	indexName string
+	// resourceIndices are the alias of all the resource indices and the events data stream
+	resourceIndices []string
+
+	extractConfig  []string
+	fullTextSearch bool
+	protector      *dataProtector
+	redactors      redactors
+	pruner         pruner
+	extractor      extractor
+	// indexedFields are the top-level object fields which can be selected, nil means all of them
+	indexedFields sets.String
+	dataStream    bool
+	fingerprinter fingerprinter
+	historyIndex  string
+	tombstones    bool
+	percolator    *percolator
 
 	index *Index
 }
@@ -62,11 +75,32 @@ func (s *ResourceStorage) List(ctx context.Context, listObject runtime.Object, o
 	if err != nil {
 		return err
 	}
-	query, err := s.genListQuery(ownerIds, opts)
+	drift, err := s.getListDrift(ctx, opts)
+	if err != nil {
+		return err
+	}
+	query, err := s.genListQuery(ctx, ownerIds, drift, opts)
 	if err != nil {
 		return err
 	}
-	r, err := s.index.Search(ctx, query, []string{s.indexName})
+	ownerChain, err := parseOwnerChainQuery(opts)
+	if err != nil {
+		return err
+	}
+	asOf, changedSince, changedBefore, err := parseHistoryQuery(opts.URLQuery)
+	if err != nil {
+		return err
+	}
+	diffRange, err := parseDiffQuery(opts.URLQuery)
+	if err != nil {
+		return err
+	}
+	historical := asOf != "" || changedSince != "" || changedBefore != "" || diffRange != nil
+	indexName, err := s.historyIndexFor(historical, "asOf, changedSince, changedBefore, diffFrom and diffTo")
+	if err != nil {
+		return err
+	}
+	r, err := s.index.Search(ctx, query, []string{indexName})
 	if err != nil {
 		return err
 	}
@@ -84,10 +118,19 @@ func (s *ResourceStorage) List(ctx context.Context, listObject runtime.Object, o
 	remain := r.GetTotal() - int64(offset) - int64(len(r.GetResources()))
 	list.SetRemainingItemCount(&remain)
 
+	fromRevisions, err := s.getFromRevisions(ctx, r.GetResources(), diffRange)
+	if err != nil {
+		return err
+	}
+
+	highlights := r.GetHighlights(FullTextObjectPath)
 	objects := make([]runtime.Object, len(r.GetResources()))
 	if unstructuredList, ok := listObject.(*unstructured.UnstructuredList); ok {
-		for _, resource := range r.GetResources() {
-			object := resource.GetObject()
+		for i, resource := range r.GetResources() {
+			object, err := s.revealObject(resource.GetObject())
+			if err != nil {
+				return err
+			}
 			uObj := &unstructured.Unstructured{}
 			byte, err := json.Marshal(object)
 			if err != nil {
@@ -100,6 +143,20 @@ func (s *ResourceStorage) List(ctx context.Context, listObject runtime.Object, o
 			if obj != uObj {
 				return fmt.Errorf("Failed to decode resource, into is %T", uObj)
 			}
+			if err := setHighlightAnnotation(uObj, highlights[i]); err != nil {
+				return err
+			}
+			if err := setDriftAnnotation(uObj, drift, getClusterName(resource.GetObject())); err != nil {
+				return err
+			}
+			if err := setListDiffAnnotation(uObj, resource, fromRevisions, diffRange); err != nil {
+				return err
+			}
+			if ownerChain {
+				if err := s.setOwnerChainAnnotation(ctx, uObj, resource); err != nil {
+					return err
+				}
+			}
 			objects = append(objects, uObj)
 
 		}
@@ -130,7 +187,10 @@ func (s *ResourceStorage) List(ctx context.Context, listObject runtime.Object, o
 	expected := reflect.New(v.Type().Elem()).Interface().(runtime.Object)
 
 	for i, resource := range r.GetResources() {
-		object := resource.GetObject()
+		object, err := s.revealObject(resource.GetObject())
+		if err != nil {
+			return err
+		}
 		byte, err := json.Marshal(object)
 		if err != nil {
 			return err
@@ -139,6 +199,20 @@ func (s *ResourceStorage) List(ctx context.Context, listObject runtime.Object, o
 		if err != nil {
 			return err
 		}
+		if err := setHighlightAnnotation(obj, highlights[i]); err != nil {
+			return err
+		}
+		if err := setDriftAnnotation(obj, drift, getClusterName(resource.GetObject())); err != nil {
+			return err
+		}
+		if err := setListDiffAnnotation(obj, resource, fromRevisions, diffRange); err != nil {
+			return err
+		}
+		if ownerChain {
+			if err := s.setOwnerChainAnnotation(ctx, obj, resource); err != nil {
+				return err
+			}
+		}
 		slice.Index(i).Set(reflect.ValueOf(obj).Elem())
 
 	}
@@ -151,6 +225,8 @@ func (s *ResourceStorage) GetOwnerIds(ctx context.Context, opts *internal.ListOp
 	switch {
 	case len(opts.ClusterNames) != 1:
 		return empty, nil
+	case isEventResource(s.storageGroupResource) && (opts.OwnerUID != "" || opts.OwnerName != ""):
+		return s.getInvolvedObjectUIDs(ctx, opts)
 	case opts.OwnerUID != "":
 		result, err := s.getUIDs(ctx, opts.ClusterNames[0], []string{opts.OwnerUID}, opts.OwnerSeniority)
 		return result, err
@@ -163,71 +239,68 @@ func (s *ResourceStorage) GetOwnerIds(ctx context.Context, opts *internal.ListOp
 	}
 }
 
-func (s *ResourceStorage) getUIDsByName(ctx context.Context, opts *internal.ListOptions) ([]string, error) {
-	builder := NewQueryBuilder()
-	builder.size = 500
-	builder.source = []string{UIDPath}
+// savedSearchExpander expands the saved searches of the resource, their owner options are resolved per request
+func (s *ResourceStorage) savedSearchExpander() *savedSearchExpander {
+	return &savedSearchExpander{index: s.index, gr: s.storageGroupResource, ownerExpression: s.newOwnerExpression}
+}
 
-	if len(opts.Namespaces) != 0 {
-		builder.addExpression(NewTerms(NameSpacePath, opts.Namespaces))
+func (s *ResourceStorage) newOwnerExpression(ctx context.Context, opts *internal.ListOptions) (Expression, error) {
+	ownerIds, err := s.GetOwnerIds(ctx, opts)
+	if err != nil {
+		return nil, err
 	}
+	return s.ownerIdsExpression(ownerIds), nil
+}
 
-	if !opts.OwnerGroupResource.Empty() {
-		groupResource := opts.OwnerGroupResource
-		builder.addExpression(NewTerms(GroupPath, []string{groupResource.Group}))
-		builder.addExpression(NewTerms(ResourcePath, []string{groupResource.Resource}))
+// ownerIdsExpression matches the objects owned by the owners, or the events involving them
+func (s *ResourceStorage) ownerIdsExpression(ownerIds []string) Expression {
+	// an empty slice matches nothing, nil would be encoded as null
+	ownerIds = append([]string{}, ownerIds...)
+	if isEventResource(s.storageGroupResource) {
+		return NewTerms(InvolvedObjectUIDPath, ownerIds)
 	}
+	return NewTerms(OwnerReferencePath, ownerIds)
+}
 
-	builder.addExpression(NewTerms(NamePath, []string{opts.OwnerName}))
-
-	cluster := opts.ClusterNames[0]
-	builder.addExpression(NewTerms(ClusterPath, []string{cluster}))
-
-	r, err := s.index.Search(ctx, builder.build(), []string{s.resourceAlias})
+func (s *ResourceStorage) getUIDsByName(ctx context.Context, opts *internal.ListOptions) ([]string, error) {
+	owners, err := s.getOwnersByName(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
-
-	var uids []string
-	for _, resource := range r.GetResources() {
-		uid := simpleMapExtract("metadata.uid", resource.GetObject())
-		if uid == nil {
-			return nil, fmt.Errorf("error")
-		}
-		uids = append(uids, uid.(string))
+	descendants, err := s.getDescendants(ctx, opts.ClusterNames[0], owners, opts.OwnerSeniority)
+	if err != nil {
+		return nil, err
 	}
-	return s.getUIDs(ctx, cluster, uids, opts.OwnerSeniority)
+	return ownerUIDs(descendants), nil
 }
 
-func (s *ResourceStorage) getUIDs(ctx context.Context, cluster string, uids []string, seniority int) ([]string, error) {
-	if seniority == 0 {
-		return uids, nil
+// getOwnersByName pages through the owners of the name, they are limited like the descendants
+func (s *ResourceStorage) getOwnersByName(ctx context.Context, opts *internal.ListOptions) ([]ownerNode, error) {
+	var query []Expression
+	if len(opts.Namespaces) != 0 {
+		query = append(query, NewTerms(NameSpacePath, opts.Namespaces))
 	}
-	builder := NewQueryBuilder()
-	builder.size = 500
-	builder.source = []string{UIDPath}
-	builder.addExpression(NewTerms(OwnerReferencePath, uids))
-	builder.addExpression(NewTerms(ClusterPath, []string{cluster}))
 
-	r, err := s.index.Search(ctx, builder.build(), []string{s.resourceAlias})
+	if !opts.OwnerGroupResource.Empty() {
+		groupResource := opts.OwnerGroupResource
+		query = append(query, NewTerms(GroupPath, []string{groupResource.Group}))
+		query = append(query, NewTerms(ResourcePath, []string{groupResource.Resource}))
+	}
+
+	query = append(query, NewTerms(NamePath, []string{opts.OwnerName}))
+	return s.searchOwnerNodes(ctx, opts.ClusterNames[0], [][]Expression{query}, maxOwnerUIDs)
+}
+
+func (s *ResourceStorage) getUIDs(ctx context.Context, cluster string, uids []string, seniority int) ([]string, error) {
+	descendants, err := s.getDescendants(ctx, cluster, newOwnerNodes(uids), seniority)
 	if err != nil {
 		return nil, err
 	}
-	uids = []string{}
-	for _, resource := range r.GetResources() {
-		result := simpleMapExtract("metadata.uid", resource.GetObject())
-		if result == nil {
-			return nil, fmt.Errorf("extract uid failure, targetObject is %v", resource.GetObject())
-		}
-		uid, ok := result.(string)
-		if !ok {
-			return nil, fmt.Errorf("result to string failure, targetObject is %v", resource.GetObject())
-		}
-		uids = append(uids, uid)
-	}
-	return s.getUIDs(ctx, cluster, uids, seniority-1)
+	return ownerUIDs(descendants), nil
 }
 
+// Get returns the live object, the tombstones and the revisions of an object are listed with its name,
+// because the get requests carry no url query
 func (s *ResourceStorage) Get(ctx context.Context, cluster, namespace, name string, into runtime.Object) error {
 	builder := NewQueryBuilder()
 	builder.addExpression(NewTerms(GroupPath, []string{s.storageGroupResource.Group}))
@@ -236,17 +309,28 @@ func (s *ResourceStorage) Get(ctx context.Context, cluster, namespace, name stri
 	builder.addExpression(NewTerms(NamePath, []string{name}))
 	builder.addExpression(NewTerms(NameSpacePath, []string{namespace}))
 	builder.addExpression(NewTerms(ClusterPath, []string{cluster}))
+	if s.dataStream {
+		builder.size = 1
+		builder.sort = []map[string]interface{}{{TimestampPath: map[string]interface{}{"order": "desc"}}}
+	}
+	builder.addExpression(newNotDeletedExpression())
 
 	r, err := s.index.Search(ctx, builder.build(), []string{s.indexName})
 	if err != nil {
 		return err
 	}
-	cnt := len(r.GetResources())
-	if cnt == 0 {
+	if len(r.GetResources()) == 0 {
 		return genericstorage.NewKeyNotFoundError(fmt.Sprintf("%s/%s", cluster, namespace+"/"+name), 0)
 	}
-	resource := r.GetResources()[0]
-	object := resource.Object
+	return s.decodeResource(r.GetResources()[0], into)
+}
+
+// decodeResource decodes the revealed object of the resource into the object
+func (s *ResourceStorage) decodeResource(resource *Resource, into runtime.Object) error {
+	object, err := s.revealObject(resource.Object)
+	if err != nil {
+		return err
+	}
 	byte, err := json.Marshal(object)
 	if err != nil {
 		return err
@@ -270,10 +354,41 @@ func (s *ResourceStorage) Delete(ctx context.Context, cluster string, obj runtim
 	if len(metaobj.GetUID()) == 0 {
 		return nil
 	}
-	err = s.index.DeleteById(ctx, string(metaobj.GetUID()), s.indexName)
+	if s.dataStream {
+		return s.deleteEventRevisions(ctx, string(metaobj.GetUID()))
+	}
+	previous, err := s.previousDocument(ctx, string(metaobj.GetUID()))
+	if err != nil {
+		return err
+	}
+	if s.tombstones {
+		err = s.markDeleted(ctx, string(metaobj.GetUID()))
+	} else {
+		err = s.index.DeleteById(ctx, string(metaobj.GetUID()), s.indexName)
+	}
 	if err != nil {
 		return err
 	}
+	s.percolate(cluster, previous, nil, string(metaobj.GetUID()), metaobj.GetResourceVersion())
+	if s.historyIndex != "" {
+		doc := map[string]interface{}{
+			"group":     s.storageGroupResource.Group,
+			"version":   s.storageVersion.Version,
+			"resource":  s.storageGroupResource.Resource,
+			"name":      metaobj.GetName(),
+			"namespace": metaobj.GetNamespace(),
+			"object": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"uid":             string(metaobj.GetUID()),
+					"name":            metaobj.GetName(),
+					"namespace":       metaobj.GetNamespace(),
+					"resourceVersion": metaobj.GetResourceVersion(),
+					"annotations":     map[string]interface{}{ClusterAnnotation: cluster},
+				},
+			},
+		}
+		return s.appendRevision(ctx, cluster, string(metaobj.GetUID()), resourceVersionOf(previous), metaobj.GetResourceVersion(), revisionOperationDelete, doc)
+	}
 	return nil
 }
 
@@ -291,10 +406,28 @@ func (s *ResourceStorage) upsert(ctx context.Context, cluster string, obj runtim
 		return err
 	}
 
-	custom := make(map[string]string)
-	if unstructured, ok := obj.(*unstructured.Unstructured); ok && len(s.extractConfig) > 0 {
+	object, err := toUnstructuredObject(obj)
+	if err != nil {
+		return err
+	}
+	if size := s.pruner.prune(object); size > 0 {
+		prunedBytes.Add(s.storageGroupResource.String(), int64(size))
+	}
+	s.redactors.redact(object)
+	// the fingerprint is computed before the encryption, which is not deterministic
+	fingerprint := s.fingerprinter.fingerprint(object)
+	if s.protector != nil {
+		if err := s.protector.protect(object); err != nil {
+			return err
+		}
+	}
+
+	extracted := s.extractor.extract(object)
+
+	custom := make(map[string]interface{})
+	if len(s.extractConfig) > 0 {
 		for _, path := range s.extractConfig {
-			result := simpleMapExtract(path, unstructured.Object)
+			result := simpleMapExtract(path, object)
 			if result != nil {
 				value, err := json.Marshal(result)
 				if err == nil {
@@ -304,22 +437,47 @@ func (s *ResourceStorage) upsert(ctx context.Context, cluster string, obj runtim
 		}
 	}
 
-	if feature.FeatureGate.Enabled(AllowObjectFullTextSearch) {
-		value, err := json.Marshal(obj)
+	if s.fullTextSearch {
+		value, err := json.Marshal(object)
 		if err == nil {
 			custom["fullTextObject"] = string(value)
 		}
 	}
 
-	resource := s.genDocument(metaObj, gvk, custom)
-	err = s.index.Upsert(ctx, s.indexName, string(metaObj.GetUID()), resource)
+	stored := &unstructured.Unstructured{Object: object}
+	if keys := mapKeys(stored.GetLabels()); len(keys) > 0 {
+		custom["labelKeys"] = keys
+	}
+	if keys := mapKeys(stored.GetAnnotations()); len(keys) > 0 {
+		custom["annotationKeys"] = keys
+	}
+
+	resource := s.genDocument(metaObj, gvk, object, extracted, custom, fingerprint)
+	previous, err := s.previousDocument(ctx, string(metaObj.GetUID()))
 	if err != nil {
 		return err
 	}
+	if s.dataStream {
+		err = s.createEventRevision(ctx, string(metaObj.GetUID()), metaObj.GetResourceVersion(), resource)
+	} else {
+		err = s.index.Upsert(ctx, s.indexName, string(metaObj.GetUID()), resource)
+	}
+	if err != nil {
+		if mappingErr, ok := asMappingError(err, s.indexName); ok {
+			mappingRejections.Add(s.storageGroupResource.String(), 1)
+			klog.ErrorS(mappingErr, "Failed to store resource", "cluster", cluster, "namespace", metaObj.GetNamespace(), "name", metaObj.GetName())
+			return mappingErr
+		}
+		return err
+	}
+	s.percolate(cluster, previous, resource, string(metaObj.GetUID()), metaObj.GetResourceVersion())
+	if s.historyIndex != "" {
+		return s.appendRevision(ctx, cluster, string(metaObj.GetUID()), resourceVersionOf(previous), metaObj.GetResourceVersion(), revisionOperationUpsert, resource)
+	}
 	return nil
 }
 
-func (s *ResourceStorage) genDocument(metaObj metav1.Object, gvk schema.GroupVersionKind, custom map[string]string) map[string]interface{} {
+func (s *ResourceStorage) genDocument(metaObj metav1.Object, gvk schema.GroupVersionKind, object, extracted, custom map[string]interface{}, fingerprint string) map[string]interface{} {
 	requestBody := map[string]interface{}{
 		"group":           s.storageGroupResource.Group,
 		"version":         s.storageVersion.Version,
@@ -328,14 +486,34 @@ func (s *ResourceStorage) genDocument(metaObj metav1.Object, gvk schema.GroupVer
 		"name":            metaObj.GetName(),
 		"namespace":       metaObj.GetNamespace(),
 		"resourceVersion": metaObj.GetResourceVersion(),
-		"object":          metaObj,
+		"object":          object,
+	}
+	if len(extracted) > 0 {
+		requestBody[ExtractedPath] = extracted
+	}
+	if conditions := extractConditions(object); len(conditions) > 0 {
+		requestBody[ConditionsPath] = conditions
 	}
 	if len(custom) > 0 {
 		requestBody["custom"] = custom
 	}
+	if fingerprint != "" {
+		requestBody[FingerprintPath] = fingerprint
+	}
 	return requestBody
 }
 
+// revealObject decrypts the protected fields of the stored object when it is allowed
+func (s *ResourceStorage) revealObject(object map[string]interface{}) (map[string]interface{}, error) {
+	if s.protector == nil {
+		return object, nil
+	}
+	if err := s.protector.reveal(object); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
 func (s *ResourceStorage) Watch(_ context.Context, _ *internal.ListOptions) (watch.Interface, error) {
 	return nil, apierrors.NewMethodNotSupported(s.storageGroupResource, "watch")
 }
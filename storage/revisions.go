@@ -0,0 +1,215 @@
+package esstorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// URLQueryChangedSince and URLQueryChangedBefore list the resources changed in the time window from the history,
+	// each resource is returned as its latest revision in the window, the deleted resources are not listed
+	URLQueryChangedSince  = "changedSince"
+	URLQueryChangedBefore = "changedBefore"
+
+	// URLQueryDiffFrom and URLQueryDiffTo list the objects as they were at `diffTo`, which defaults to now,
+	// with the changes since `diffFrom` in the DiffAnnotation. They accept RFC3339 times and relative times like `now-1h`,
+	// the changes of a single object are listed with its name, because the get requests carry no url query
+	URLQueryDiffFrom = "diffFrom"
+	URLQueryDiffTo   = "diffTo"
+
+	// DiffAnnotation records the changes of the object between the times of the diff url queries in JSON
+	DiffAnnotation = "esstorage.clusterpedia.io/diff"
+)
+
+// RevisionDiff is the changes of the spec, labels and annotations of an object between two times
+type RevisionDiff struct {
+	From    time.Time   `json:"from"`
+	To      time.Time   `json:"to"`
+	FromRV  string      `json:"fromResourceVersion,omitempty"`
+	ToRV    string      `json:"toResourceVersion,omitempty"`
+	Created bool        `json:"created,omitempty"`
+	Deleted bool        `json:"deleted,omitempty"`
+	Changes []FieldDiff `json:"changes,omitempty"`
+}
+
+type revisionDiffRange struct {
+	from, to time.Time
+}
+
+// asOf returns the time of the returned objects, which is the end of the window
+func (r *revisionDiffRange) asOf() string {
+	return r.to.UTC().Format(dateRangeTimeLayout)
+}
+
+// parseDiffQuery parses the diff url queries, it returns nil if `diffFrom` is not set
+func parseDiffQuery(urlQuery url.Values) (*revisionDiffRange, error) {
+	from, to := urlQuery.Get(URLQueryDiffFrom), urlQuery.Get(URLQueryDiffTo)
+	if from == "" {
+		if to != "" {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("%s requires %s", URLQueryDiffTo, URLQueryDiffFrom))
+		}
+		return nil, nil
+	}
+	if to == "" {
+		to = "now"
+	}
+
+	now := time.Now()
+	diffRange := &revisionDiffRange{}
+	for _, option := range []struct {
+		key, value string
+		time       *time.Time
+	}{
+		{URLQueryDiffFrom, from, &diffRange.from},
+		{URLQueryDiffTo, to, &diffRange.to},
+	} {
+		t, err := resolveTime(option.value, now)
+		if err != nil {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("%s query: %q is neither an RFC3339 time nor a relative time like `now-1h`", option.key, option.value))
+		}
+		*option.time = t
+	}
+	if !diffRange.from.Before(diffRange.to) {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("%s must be before %s", URLQueryDiffFrom, URLQueryDiffTo))
+	}
+	return diffRange, nil
+}
+
+// newRevisionDiff compares the revisions of an object at the start and the end of the window,
+// a nil revision means the object did not exist at the time
+func newRevisionDiff(diffRange *revisionDiffRange, fromRevision, toRevision *Resource) *RevisionDiff {
+	diff := &RevisionDiff{From: diffRange.from, To: diffRange.to}
+	fromObject, toObject := map[string]interface{}{}, map[string]interface{}{}
+	if fromRevision != nil {
+		diff.FromRV, _ = simpleMapExtract("metadata.resourceVersion", fromRevision.GetObject()).(string)
+		fromObject = diffedFields(fromRevision.GetObject())
+	} else {
+		diff.Created = toRevision != nil
+	}
+	if toRevision != nil {
+		diff.ToRV, _ = simpleMapExtract("metadata.resourceVersion", toRevision.GetObject()).(string)
+		toObject = diffedFields(toRevision.GetObject())
+	} else {
+		diff.Deleted = fromRevision != nil
+	}
+	diff.Changes = diffObjects(fromObject, toObject)
+	return diff
+}
+
+// getFromRevisions returns the revisions of the listed objects at the start of the diff window by uid,
+// the revisions of the whole page are searched at once
+func (s *ResourceStorage) getFromRevisions(ctx context.Context, resources []*Resource, diffRange *revisionDiffRange) (map[string]*Resource, error) {
+	if diffRange == nil || len(resources) == 0 {
+		return nil, nil
+	}
+	uids := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		uids = append(uids, revisionUID(resource))
+	}
+
+	builder := NewQueryBuilder()
+	builder.size = len(uids)
+	builder.addExpression(NewTerms(UIDPath, uids))
+	for _, expression := range newAsOfExpressions(diffRange.from.UTC().Format(dateRangeTimeLayout)) {
+		builder.addExpression(expression)
+	}
+	r, err := s.index.Search(ctx, builder.build(), []string{s.historyIndex})
+	if err != nil {
+		return nil, err
+	}
+	revisions := make(map[string]*Resource, len(uids))
+	for _, revision := range r.GetResources() {
+		revisions[revisionUID(revision)] = revision
+	}
+	return revisions, nil
+}
+
+func revisionUID(resource *Resource) string {
+	uid, _ := simpleMapExtract("metadata.uid", resource.GetObject()).(string)
+	return uid
+}
+
+// diffedFields returns the spec, labels and annotations of the object
+func diffedFields(object map[string]interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if spec, ok := object["spec"]; ok {
+		fields["spec"] = spec
+	}
+	metadata := map[string]interface{}{}
+	for _, key := range []string{"labels", "annotations"} {
+		if value := simpleMapExtract("metadata."+key, object); value != nil {
+			metadata[key] = value
+		}
+	}
+	if len(metadata) > 0 {
+		fields["metadata"] = metadata
+	}
+	return fields
+}
+
+// parseHistoryQuery parses the url queries which are answered from the history
+func parseHistoryQuery(urlQuery url.Values) (asOf, changedSince, changedBefore string, err error) {
+	for _, option := range []struct {
+		key   string
+		value *string
+	}{
+		{URLQueryAsOf, &asOf},
+		{URLQueryChangedSince, &changedSince},
+		{URLQueryChangedBefore, &changedBefore},
+	} {
+		if *option.value, err = parseTimeRangeValue(urlQuery, option.key); err != nil {
+			return "", "", "", apierrors.NewBadRequest(err.Error())
+		}
+	}
+	return asOf, changedSince, changedBefore, nil
+}
+
+// applyChangedQuery matches the revisions created in the changed window,
+// the revisions are collapsed to the latest one of each object
+func applyChangedQuery(builder *QueryBuilder, since, before string) {
+	if since == "" && before == "" {
+		return
+	}
+	builder.addExpression(NewDateRange(RevisionTimestampPath, since, before))
+	deleted := NewTerms(RevisionOperationPath, []string{revisionOperationDelete})
+	deleted.SetLogicType(MustNot)
+	builder.addExpression(deleted)
+
+	builder.collapse = UIDPath
+	builder.sort = append(builder.sort, map[string]interface{}{
+		RevisionTimestampPath: map[string]interface{}{"order": "desc"},
+	})
+}
+
+// setListDiffAnnotation records the changes of the listed revision since the start of the diff window
+func setListDiffAnnotation(obj runtime.Object, resource *Resource, fromRevisions map[string]*Resource, diffRange *revisionDiffRange) error {
+	if diffRange == nil {
+		return nil
+	}
+	return setDiffAnnotation(obj, newRevisionDiff(diffRange, fromRevisions[revisionUID(resource)], resource))
+}
+
+func setDiffAnnotation(obj runtime.Object, diff *RevisionDiff) error {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(diff)
+	if err != nil {
+		return err
+	}
+	annotations := accessor.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[DiffAnnotation] = string(value)
+	accessor.SetAnnotations(annotations)
+	return nil
+}
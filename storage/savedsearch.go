@@ -0,0 +1,397 @@
+package esstorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	internal "github.com/clusterpedia-io/api/clusterpedia"
+	"github.com/clusterpedia-io/api/clusterpedia/fields"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	savedSearchIndex = "clusterpedia-saved-searches"
+
+	SavedSearchOwnerPath = "owner"
+
+	// URLQuerySavedSearch lists the resources matched by the saved search, the filters of the request
+	// narrow the saved query and the order of the request replaces the saved sort
+	URLQuerySavedSearch = "savedSearch"
+)
+
+var savedSearchResource = schema.GroupResource{Group: internal.GroupName, Resource: "savedsearches"}
+
+// unsavedURLQueries are applied by the list of a resource outside its compiled query,
+// they are rejected when saving because an expanded saved search would ignore them
+var unsavedURLQueries = []string{
+	URLQueryDrift, URLQueryOrphaned, URLQueryLikeObject, URLQueryOwnerChain,
+	URLQueryAsOf, URLQueryChangedSince, URLQueryChangedBefore, URLQueryDiffFrom, URLQueryDiffTo,
+}
+
+// SavedSearch is a named list query stored in Elasticsearch, the list options are stored as they are requested
+// and compiled for every request, so that the owner options are resolved to the current owners
+type SavedSearch struct {
+	Name  string `json:"name"`
+	Owner string `json:"owner"`
+
+	// Group and Resource scope the saved search, an empty resource can be listed in the collection resources
+	Group    string `json:"group"`
+	Resource string `json:"resource"`
+
+	Query     *SavedQuery        `json:"query"`
+	Sort      []internal.OrderBy `json:"sort,omitempty"`
+	CreatedAt time.Time          `json:"createdAt"`
+}
+
+// SavedQuery is the filters of the list options, the selectors are stored as strings
+type SavedQuery struct {
+	ClusterNames []string `json:"clusterNames,omitempty"`
+	Namespaces   []string `json:"namespaces,omitempty"`
+	Names        []string `json:"names,omitempty"`
+
+	LabelSelector         string `json:"labelSelector,omitempty"`
+	ExtraLabelSelector    string `json:"extraLabelSelector,omitempty"`
+	EnhancedFieldSelector string `json:"fieldSelector,omitempty"`
+
+	OwnerUID           string `json:"ownerUID,omitempty"`
+	OwnerName          string `json:"ownerName,omitempty"`
+	OwnerGroupResource string `json:"ownerGroupResource,omitempty"`
+	OwnerSeniority     int    `json:"ownerSeniority,omitempty"`
+
+	Since  *metav1.Time `json:"since,omitempty"`
+	Before *metav1.Time `json:"before,omitempty"`
+
+	// URLQuery is the encoded url query of the storage options, such as `query` and `conditionType`
+	URLQuery string `json:"urlQuery,omitempty"`
+}
+
+const savedSearchMapping = `{
+  "mappings": {
+    "properties": {
+      "name": {"type": "keyword"},
+      "owner": {"type": "keyword"},
+      "group": {"type": "keyword"},
+      "resource": {"type": "keyword"},
+      "query": {"type": "object", "enabled": false},
+      "sort": {"type": "object", "enabled": false},
+      "createdAt": {"type": "date"}
+    }
+  }
+}`
+
+// GroupResource returns the resource listed by the saved search
+func (s *SavedSearch) GroupResource() schema.GroupResource {
+	return schema.GroupResource{Group: s.Group, Resource: s.Resource}
+}
+
+func newSavedQuery(opts *internal.ListOptions) *SavedQuery {
+	query := &SavedQuery{
+		ClusterNames:   opts.ClusterNames,
+		Namespaces:     opts.Namespaces,
+		Names:          opts.Names,
+		OwnerUID:       opts.OwnerUID,
+		OwnerName:      opts.OwnerName,
+		OwnerSeniority: opts.OwnerSeniority,
+		Since:          opts.Since,
+		Before:         opts.Before,
+	}
+	if opts.LabelSelector != nil && !opts.LabelSelector.Empty() {
+		query.LabelSelector = opts.LabelSelector.String()
+	}
+	if opts.ExtraLabelSelector != nil && !opts.ExtraLabelSelector.Empty() {
+		query.ExtraLabelSelector = opts.ExtraLabelSelector.String()
+	}
+	if opts.EnhancedFieldSelector != nil && !opts.EnhancedFieldSelector.Empty() {
+		query.EnhancedFieldSelector = opts.EnhancedFieldSelector.String()
+	}
+	if !opts.OwnerGroupResource.Empty() {
+		query.OwnerGroupResource = opts.OwnerGroupResource.String()
+	}
+	if len(opts.URLQuery) != 0 {
+		urlQuery := make(url.Values, len(opts.URLQuery))
+		for key, values := range opts.URLQuery {
+			if key != URLQuerySavedSearch {
+				urlQuery[key] = values
+			}
+		}
+		query.URLQuery = urlQuery.Encode()
+	}
+	return query
+}
+
+// listOptions parses the saved query into list options
+func (q *SavedQuery) listOptions() (*internal.ListOptions, error) {
+	opts := &internal.ListOptions{
+		ClusterNames:   q.ClusterNames,
+		Namespaces:     q.Namespaces,
+		Names:          q.Names,
+		OwnerUID:       q.OwnerUID,
+		OwnerName:      q.OwnerName,
+		OwnerSeniority: q.OwnerSeniority,
+		Since:          q.Since,
+		Before:         q.Before,
+	}
+	var err error
+	if q.LabelSelector != "" {
+		if opts.LabelSelector, err = labels.Parse(q.LabelSelector); err != nil {
+			return nil, err
+		}
+	}
+	if q.ExtraLabelSelector != "" {
+		if opts.ExtraLabelSelector, err = labels.Parse(q.ExtraLabelSelector); err != nil {
+			return nil, err
+		}
+	}
+	if q.EnhancedFieldSelector != "" {
+		if opts.EnhancedFieldSelector, err = fields.Parse(q.EnhancedFieldSelector); err != nil {
+			return nil, err
+		}
+	}
+	if q.OwnerGroupResource != "" {
+		opts.OwnerGroupResource = schema.ParseGroupResource(q.OwnerGroupResource)
+	}
+	if opts.URLQuery, err = url.ParseQuery(q.URLQuery); err != nil {
+		return nil, err
+	}
+	// the tombstones are hidden by the request unless the saved search asks for them
+	if !opts.URLQuery.Has(URLQueryIncludeDeleted) && !opts.URLQuery.Has(URLQueryOnlyDeleted) {
+		opts.URLQuery.Set(URLQueryIncludeDeleted, "true")
+	}
+	return opts, nil
+}
+
+// SaveSearch stores the list options of the resource as the saved search of the name, the saved search
+// can only be replaced by its owner. An empty resource saves a search of the collection resources
+func (s *StorageFactory) SaveSearch(ctx context.Context, name, owner string, gr schema.GroupResource, opts *internal.ListOptions) (*SavedSearch, error) {
+	if name == "" {
+		return nil, apierrors.NewBadRequest("name of the saved search is required")
+	}
+	if opts.URLQuery.Get(URLQuerySavedSearch) != "" {
+		return nil, apierrors.NewBadRequest("saved searches cannot reference other saved searches")
+	}
+	for _, key := range unsavedURLQueries {
+		if opts.URLQuery.Has(key) {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("%s cannot be saved in a saved search", key))
+		}
+	}
+	for _, filter := range eventFilters {
+		if opts.URLQuery.Has(filter.key) {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("%s cannot be saved in a saved search", filter.key))
+		}
+	}
+	if gr.Resource == "" && (opts.OwnerUID != "" || opts.OwnerName != "") {
+		return nil, apierrors.NewBadRequest("owner options require the resource of the saved search")
+	}
+
+	search := &SavedSearch{
+		Name:      name,
+		Owner:     owner,
+		Group:     gr.Group,
+		Resource:  gr.Resource,
+		Query:     newSavedQuery(opts),
+		Sort:      opts.OrderBy,
+		CreatedAt: time.Now().UTC(),
+	}
+	// the saved query is compiled to reject the invalid options before it is stored
+	savedOpts, err := search.Query.listOptions()
+	if err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid saved search %q: %v", name, err))
+	}
+	if err := applyListOptionToQueryBuilder(ctx, nil, NewQueryBuilder(), savedOpts); err != nil {
+		return nil, err
+	}
+	doc, err := toSavedSearchDocument(search)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ensureIndex(s.index.client, savedSearchMapping, savedSearchIndex); err != nil {
+		return nil, err
+	}
+	// the entry is replaced only if it is not written since its owner is checked
+	existing, version, err := getVersionedSavedSearch(ctx, s.index, name)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		err = s.index.Create(ctx, savedSearchIndex, name, doc)
+	} else if existing.Owner != owner {
+		err = &ESError{StatusCode: http.StatusConflict}
+	} else {
+		err = s.index.ReplaceIfVersion(ctx, savedSearchIndex, name, doc, version)
+	}
+	if esError, ok := err.(*ESError); ok && esError.StatusCode == http.StatusConflict {
+		return nil, apierrors.NewConflict(savedSearchResource, name, fmt.Errorf("the saved search is owned by another owner or changed concurrently"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return search, nil
+}
+
+func (s *StorageFactory) GetSavedSearch(ctx context.Context, name string) (*SavedSearch, error) {
+	return getSavedSearch(ctx, s.index, name)
+}
+
+// ListSavedSearches lists the saved searches of the owner, or every saved search if the owner is empty
+func (s *StorageFactory) ListSavedSearches(ctx context.Context, owner string) ([]*SavedSearch, error) {
+	builder := NewQueryBuilder()
+	if owner != "" {
+		builder.addExpression(NewTerms(SavedSearchOwnerPath, []string{owner}))
+	}
+	sources, err := searchAllSources(ctx, s.index, builder, "name", []string{savedSearchIndex})
+	if esError, ok := err.(*ESError); ok && esError.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	searches := make([]*SavedSearch, 0, len(sources))
+	for _, source := range sources {
+		search, err := fromSavedSearchDocument(source)
+		if err != nil {
+			return nil, err
+		}
+		searches = append(searches, search)
+	}
+	return searches, nil
+}
+
+// DeleteSavedSearch deletes the saved search of the owner
+func (s *StorageFactory) DeleteSavedSearch(ctx context.Context, name, owner string) error {
+	existing, version, err := getVersionedSavedSearch(ctx, s.index, name)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return apierrors.NewNotFound(savedSearchResource, name)
+	}
+	if existing.Owner != owner {
+		return apierrors.NewConflict(savedSearchResource, name, fmt.Errorf("the saved search is owned by another owner"))
+	}
+	err = s.index.DeleteIfVersion(ctx, savedSearchIndex, name, version)
+	if esError, ok := err.(*ESError); ok {
+		switch esError.StatusCode {
+		case http.StatusNotFound:
+			return apierrors.NewNotFound(savedSearchResource, name)
+		case http.StatusConflict:
+			return apierrors.NewConflict(savedSearchResource, name, fmt.Errorf("the saved search is changed concurrently"))
+		}
+	}
+	return err
+}
+
+func getSavedSearch(ctx context.Context, index *Index, name string) (*SavedSearch, error) {
+	source, err := index.GetSource(ctx, savedSearchIndex, name)
+	if err != nil {
+		return nil, err
+	}
+	if source == nil {
+		return nil, apierrors.NewNotFound(savedSearchResource, name)
+	}
+	return fromSavedSearchDocument(source)
+}
+
+// getVersionedSavedSearch returns the saved search with the version of its entry, or nil if it is not found
+func getVersionedSavedSearch(ctx context.Context, index *Index, name string) (*SavedSearch, *DocumentVersion, error) {
+	source, version, err := index.GetVersionedSource(ctx, savedSearchIndex, name)
+	if err != nil || source == nil {
+		return nil, nil, err
+	}
+	search, err := fromSavedSearchDocument(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	return search, version, nil
+}
+
+// savedSearchExpander expands the saved searches referenced by the list requests of a resource
+type savedSearchExpander struct {
+	index *Index
+	gr    schema.GroupResource
+
+	// ownerExpression resolves the owner options of a saved search, they are rejected if it is nil
+	ownerExpression func(ctx context.Context, opts *internal.ListOptions) (Expression, error)
+}
+
+// applySavedSearch adds the query of the saved search in the url query and returns its sort,
+// the saved searches are compiled without an expander, so they cannot reference other saved searches
+func applySavedSearch(ctx context.Context, expander *savedSearchExpander, builder *QueryBuilder, opts *internal.ListOptions) ([]internal.OrderBy, error) {
+	name := opts.URLQuery.Get(URLQuerySavedSearch)
+	if name == "" {
+		return nil, nil
+	}
+	if expander == nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("%s is not supported here", URLQuerySavedSearch))
+	}
+	search, err := getSavedSearch(ctx, expander.index, name)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("saved search %q is not found", name))
+		}
+		return nil, err
+	}
+	if search.GroupResource() != expander.gr {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("saved search %q lists %s", name, search.GroupResource()))
+	}
+	savedOpts, err := search.Query.listOptions()
+	if err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid saved search %q: %v", name, err))
+	}
+
+	saved := NewQueryBuilder()
+	if err := applyListOptionToQueryBuilder(ctx, nil, saved, savedOpts); err != nil {
+		return nil, err
+	}
+	if savedOpts.OwnerUID != "" || savedOpts.OwnerName != "" {
+		// the owners are resolved in the cluster of the request if the saved search is not limited to a cluster
+		if len(savedOpts.ClusterNames) == 0 {
+			savedOpts.ClusterNames = opts.ClusterNames
+		}
+		if expander.ownerExpression == nil || len(savedOpts.ClusterNames) != 1 {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("the owner options of saved search %q require a single cluster", name))
+		}
+		owners, err := expander.ownerExpression(ctx, savedOpts)
+		if err != nil {
+			return nil, err
+		}
+		saved.addExpression(owners)
+	}
+	builder.addExpression(&saved.boolExp)
+	// an unset saved highlight keeps the highlight of the request
+	if saved.highlight != nil {
+		builder.highlight = saved.highlight
+	}
+	return search.Sort, nil
+}
+
+func toSavedSearchDocument(search *SavedSearch) (map[string]interface{}, error) {
+	data, err := json.Marshal(search)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func fromSavedSearchDocument(doc map[string]interface{}) (*SavedSearch, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var search SavedSearch
+	if err := json.Unmarshal(data, &search); err != nil {
+		return nil, err
+	}
+	return &search, nil
+}
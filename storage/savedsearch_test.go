@@ -0,0 +1,22 @@
+package esstorage
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	internal "github.com/clusterpedia-io/api/clusterpedia"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestSaveSearchRejectsUnsavedURLQueries(t *testing.T) {
+	s := &StorageFactory{}
+	gr := schema.GroupResource{Group: "apps", Resource: "deployments"}
+	for _, key := range []string{URLQueryDrift, URLQueryAsOf, URLQueryDiffFrom, URLQueryOrphaned, URLQueryEventReason} {
+		opts := &internal.ListOptions{URLQuery: url.Values{key: {"true"}}}
+		if _, err := s.SaveSearch(context.Background(), "search", "owner", gr, opts); !apierrors.IsBadRequest(err) {
+			t.Errorf("%s: expected a bad request, got %v", key, err)
+		}
+	}
+}
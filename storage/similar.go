@@ -0,0 +1,99 @@
+package esstorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	internal "github.com/clusterpedia-io/api/clusterpedia"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// URLQueryLikeObject lists the resources most similar to the object by spec, labels and images,
+	// it is written as `<cluster>/<namespace>/<name>` or `<cluster>/<name>` for cluster-scoped resources.
+	// The results are ordered by relevance unless an order is specified, and the object itself is excluded
+	URLQueryLikeObject = "likeObject"
+
+	ImagesPath = "extracted.images"
+)
+
+// newLikeObjectExpressions returns the query of the resources similar to the object of the likeObject option
+func (s *ResourceStorage) newLikeObjectExpressions(ctx context.Context, opts *internal.ListOptions) ([]Expression, error) {
+	value := opts.URLQuery.Get(URLQueryLikeObject)
+	if value == "" {
+		return nil, nil
+	}
+	if !s.fullTextSearch {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("likeObject requires the full text search of %s", s.storageGroupResource))
+	}
+
+	var cluster, namespace, name string
+	switch parts := strings.Split(value, "/"); len(parts) {
+	case 2:
+		cluster, name = parts[0], parts[1]
+	case 3:
+		cluster, namespace, name = parts[0], parts[1], parts[2]
+	default:
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid likeObject %q, it must be <cluster>/<namespace>/<name>", value))
+	}
+
+	builder := NewQueryBuilder()
+	builder.size = 1
+	builder.addExpression(NewTerms(ClusterPath, []string{cluster}))
+	builder.addExpression(NewTerms(NamePath, []string{name}))
+	if namespace != "" {
+		builder.addExpression(NewTerms(NameSpacePath, []string{namespace}))
+	}
+	builder.addExpression(newNotDeletedExpression())
+	r, err := s.index.Search(ctx, builder.build(), []string{s.indexName})
+	if err != nil {
+		return nil, err
+	}
+	hits := r.Hits.Hits
+	if len(hits) == 0 {
+		return nil, apierrors.NewNotFound(s.storageGroupResource, value)
+	}
+	object := hits[0].Source.GetObject()
+
+	// the object is compared as the JSON of its labels and spec, like the indexed full text object
+	like := map[string]interface{}{}
+	if labels := simpleMapExtract("metadata.labels", object); labels != nil {
+		like["labels"] = labels
+	}
+	if spec, ok := object["spec"]; ok {
+		like["spec"] = spec
+	}
+	text, err := json.Marshal(like)
+	if err != nil {
+		return nil, err
+	}
+
+	expressions := []Expression{NewMoreLikeThis([]string{string(text)}, FullTextObjectPath)}
+
+	if uid, ok := simpleMapExtract("metadata.uid", object).(string); ok {
+		self := NewTerms(UIDPath, []string{uid})
+		self.SetLogicType(MustNot)
+		expressions = append(expressions, self)
+	}
+
+	// sharing images boosts the relevance without excluding other resources
+	var images []string
+	switch value := s.extractor.extract(object)["images"].(type) {
+	case string:
+		images = append(images, value)
+	case []interface{}:
+		for _, item := range value {
+			if image, ok := item.(string); ok {
+				images = append(images, image)
+			}
+		}
+	}
+	if len(images) > 0 {
+		sameImages := NewTerms(ImagesPath, images)
+		sameImages.SetLogicType(Should)
+		expressions = append(expressions, sameImages)
+	}
+	return expressions, nil
+}
@@ -0,0 +1,112 @@
+package esstorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const defaultWebhookTimeout = 10 * time.Second
+
+// MatchSink receives the match events of the registered queries
+type MatchSink interface {
+	Send(ctx context.Context, event *MatchEvent) error
+}
+
+// MatchSinkConfig configures a built-in sink, the type is one of `log`, `webhook` and `file`
+type MatchSinkConfig struct {
+	Type string `yaml:"type"`
+
+	// URL is the endpoint of the webhook sink, the events are posted in JSON
+	URL string `yaml:"url"`
+	// Timeout of the webhook requests, it defaults to 10s
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Path is the file of the file sink, the events are appended as JSON lines
+	Path string `yaml:"path"`
+}
+
+func newMatchSink(config *MatchSinkConfig) (MatchSink, error) {
+	switch config.Type {
+	case "log":
+		return logSink{}, nil
+	case "webhook":
+		if config.URL == "" {
+			return nil, fmt.Errorf("url is required by the webhook sink")
+		}
+		timeout := config.Timeout
+		if timeout <= 0 {
+			timeout = defaultWebhookTimeout
+		}
+		return &webhookSink{url: config.URL, client: &http.Client{Timeout: timeout}}, nil
+	case "file":
+		if config.Path == "" {
+			return nil, fmt.Errorf("path is required by the file sink")
+		}
+		return &fileSink{path: config.Path}, nil
+	default:
+		return nil, fmt.Errorf("unsupported sink type %q", config.Type)
+	}
+}
+
+type logSink struct{}
+
+func (logSink) Send(_ context.Context, event *MatchEvent) error {
+	klog.InfoS("Match query", "query", event.Query, "match", event.Match, "cluster", event.Cluster,
+		"resource", event.Resource, "namespace", event.Namespace, "name", event.Name, "resourceVersion", event.ResourceVersion)
+	return nil
+}
+
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *webhookSink) Send(ctx context.Context, event *MatchEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s responded %s", s.url, resp.Status)
+	}
+	return nil
+}
+
+type fileSink struct {
+	path string
+	lock sync.Mutex
+}
+
+func (s *fileSink) Send(_ context.Context, event *MatchEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
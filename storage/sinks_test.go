@@ -0,0 +1,88 @@
+package esstorage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWebhookSink(t *testing.T) {
+	var received []*MatchEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var event MatchEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if event.Name == "rejected" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		received = append(received, &event)
+	}))
+	defer server.Close()
+
+	sink, err := newMatchSink(&MatchSinkConfig{Type: "webhook", URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := &MatchEvent{Query: "unready", Match: MatchStarted, Cluster: "prod", Resource: "pods", Name: "nginx"}
+	if err := sink.Send(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 1 || received[0].Query != "unready" || received[0].Name != "nginx" {
+		t.Errorf("received %+v, want the sent event", received)
+	}
+
+	if err := sink.Send(context.Background(), &MatchEvent{Name: "rejected"}); err == nil {
+		t.Error("an error response of the webhook should be returned")
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "matches.jsonl")
+	sink, err := newMatchSink(&MatchSinkConfig{Type: "file", Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, match := range []string{MatchStarted, MatchStopped} {
+		if err := sink.Send(context.Background(), &MatchEvent{Query: "unready", Match: match, Name: "nginx"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var matches []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event MatchEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+		matches = append(matches, event.Match)
+	}
+	if len(matches) != 2 || matches[0] != MatchStarted || matches[1] != MatchStopped {
+		t.Errorf("appended matches = %v, want [%s %s]", matches, MatchStarted, MatchStopped)
+	}
+}
+
+func TestNewMatchSinkErrors(t *testing.T) {
+	for _, config := range []MatchSinkConfig{{Type: "webhook"}, {Type: "file"}, {Type: "kafka"}} {
+		if _, err := newMatchSink(&config); err == nil {
+			t.Errorf("newMatchSink(%+v) should fail", config)
+		}
+	}
+}
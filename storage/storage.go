@@ -6,11 +6,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
 
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
 
 	internal "github.com/clusterpedia-io/api/clusterpedia"
 	"github.com/clusterpedia-io/clusterpedia/pkg/storage"
+	"github.com/clusterpedia-io/clusterpedia/pkg/utils/feature"
 )
 
 const indexPrefix = "clusterpedia"
@@ -18,6 +21,18 @@ const indexPrefix = "clusterpedia"
 type StorageFactory struct {
 	index      *Index
 	indexAlias string
+	config     *Config
+	protectors map[schema.GroupResource]*dataProtector
+	redactors  map[string]redactors
+	pruners    pruners
+	extractors extractors
+	mappings   map[schema.GroupResource]*MappingOverride
+
+	fingerprinters fingerprinters
+	percolator     *percolator
+
+	tombstoneLock    sync.Mutex
+	tombstoneIndices sets.String
 }
 
 func (s *StorageFactory) NewResourceStorage(config *storage.ResourceStorageConfig) (storage.ResourceStorage, error) {
@@ -27,19 +42,79 @@ func (s *StorageFactory) NewResourceStorage(config *storage.ResourceStorageConfi
 		storageGroupResource: config.StorageGroupResource,
 		storageVersion:       config.StorageVersion,
 		memoryVersion:        config.MemoryVersion,
-		resourceAlias:        s.indexAlias,
+		resourceIndices:      s.resourceIndices(),
 		index:                s.index,
 	}
 	// indexAlias: ${prefix}-${group}-${resource}
 	storage.indexName = generateIndexName(config.StorageGroupResource.Group, config.StorageGroupResource.Resource)
-	var mapping = GetIndexMapping(s.indexAlias, config.GroupResource)
-	err := ensureIndex(s.index.client, mapping, storage.indexName)
+	mapping, err := GetIndexMapping(s.indexAlias, config.StorageGroupResource, s.mappings[config.StorageGroupResource])
 	if err != nil {
 		return nil, err
 	}
+	if isEventResource(config.StorageGroupResource) && s.config.Events.DataStream {
+		if err := ensureEventDataStream(context.Background(), s.index, &s.config.Events, storage.indexName, mapping); err != nil {
+			return nil, err
+		}
+		storage.dataStream = true
+	} else if err := ensureIndex(s.index.client, mapping, storage.indexName); err != nil {
+		return nil, err
+	}
+	if storage.indexedFields, err = indexedObjectFields(mapping); err != nil {
+		return nil, err
+	}
+	storage.extractor = s.extractors.extractorFor(config.StorageGroupResource)
+	if len(storage.extractor) > 0 {
+		if err := s.index.PutMapping(context.Background(), storage.indexName, storage.extractor.mapping()); err != nil {
+			return nil, err
+		}
+	}
 	if storage.storageGroupResource.Resource == ResourceConfigmap {
 		storage.extractConfig = []string{"data"}
 	}
+	// secrets are never indexed as full text
+	if storage.storageGroupResource != (schema.GroupResource{Resource: ResourceSecret}) {
+		storage.fullTextSearch = s.config.FullTextSearch.Enabled(config.StorageGroupResource, feature.FeatureGate.Enabled(AllowObjectFullTextSearch))
+	}
+	storage.protector = s.protectors[config.StorageGroupResource]
+	storage.redactors = redactorsFor(s.redactors, config.StorageGroupResource)
+	storage.pruner = s.pruners.prunerFor(config.StorageGroupResource)
+	storage.fingerprinter = s.fingerprinters.fingerprinterFor(config.StorageGroupResource)
+
+	// the revisions of the events data stream are not compared with the previous ones
+	if !storage.dataStream {
+		storage.percolator = s.percolator
+	}
+
+	if !storage.dataStream && s.config.Tombstones.Enabled(config.StorageGroupResource) {
+		if err := s.index.PutMapping(context.Background(), storage.indexName, tombstoneMapping); err != nil {
+			return nil, err
+		}
+		storage.tombstones = true
+		s.addTombstoneIndex(storage.indexName)
+	}
+
+	// the revisions of the events data stream are kept by the data stream
+	if !storage.dataStream && s.config.History.Enabled(config.StorageGroupResource) {
+		historyIndex := generateHistoryIndexName(config.StorageGroupResource.Group, config.StorageGroupResource.Resource)
+		historyMapping, err := GetIndexMapping(historyAlias, config.StorageGroupResource, s.mappings[config.StorageGroupResource])
+		if err != nil {
+			return nil, err
+		}
+		if err := ensureIndex(s.index.client, historyMapping, historyIndex); err != nil {
+			return nil, err
+		}
+		properties := storage.extractor.mapping()
+		if properties == nil {
+			properties = map[string]interface{}{}
+		}
+		for key, value := range revisionMapping {
+			properties[key] = value
+		}
+		if err := s.index.PutMapping(context.Background(), historyIndex, properties); err != nil {
+			return nil, err
+		}
+		storage.historyIndex = historyIndex
+	}
 	return storage, nil
 }
 
@@ -56,7 +131,12 @@ func (s *StorageFactory) GetResourceVersions(ctx context.Context, cluster string
 	builder := NewQueryBuilder()
 	builder.source = []string{"group", "version", "resource", "namespace", "name", "resourceVersion"}
 	builder.addExpression(NewTerms(ClusterPath, []string{cluster}))
-	resps, err := s.index.SearchAll(ctx, builder.build(), []string{s.indexAlias})
+	builder.addExpression(newNotDeletedExpression())
+	if s.config.Events.DataStream {
+		// the revisions of an event are ordered by time, so the latest one sets its resource version
+		builder.sort = []map[string]interface{}{{TimestampPath: map[string]interface{}{"order": "asc", "missing": "_first", "unmapped_type": "date"}}}
+	}
+	resps, err := s.index.SearchAll(ctx, builder.build(), s.resourceIndices())
 	if err != nil {
 		esError, ok := err.(*ESError)
 		if ok && (esError.StatusCode == 404 || esError.StatusCode == 503) {
@@ -101,6 +181,10 @@ func (s *StorageFactory) CleanCluster(ctx context.Context, cluster string) error
 			targetIndex = append(targetIndex, indexName)
 		}
 	}
+	// the backing indices of the events data stream are hidden behind the data stream name
+	if s.config.Events.DataStream {
+		targetIndex = append(targetIndex, generateIndexName("", ResourceEvent))
+	}
 	s.index.DeleteByQuery(ctx, query, targetIndex...)
 	if err != nil {
 		return err
@@ -0,0 +1,81 @@
+package esstorage
+
+import (
+	"context"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const defaultSuggestSize = 10
+
+// SuggestOptions scopes a name typeahead query
+type SuggestOptions struct {
+	Prefix string
+
+	ClusterNames   []string
+	Namespaces     []string
+	GroupResources []schema.GroupResource
+
+	// Size is the max number of suggestions returned
+	Size int
+}
+
+type NameSuggestion struct {
+	Cluster   string  `json:"cluster"`
+	Namespace string  `json:"namespace,omitempty"`
+	Name      string  `json:"name"`
+	Group     string  `json:"group"`
+	Version   string  `json:"version"`
+	Resource  string  `json:"resource"`
+	Kind      string  `json:"kind"`
+	Score     float32 `json:"score"`
+}
+
+// SuggestNames returns the top matches for a name prefix across clusters and resource types,
+// ranked by relevance
+func (s *StorageFactory) SuggestNames(ctx context.Context, opts *SuggestOptions) ([]*NameSuggestion, error) {
+	prefix := strings.TrimSpace(opts.Prefix)
+	if prefix == "" {
+		return nil, nil
+	}
+	size := opts.Size
+	if size <= 0 {
+		size = defaultSuggestSize
+	}
+
+	builder := NewQueryBuilder()
+	builder.size = size
+	builder.source = []string{GroupPath, VersionPath, ResourcePath, "kind", "name", "namespace", ClusterPath}
+	builder.addExpression(newNamePrefixExpression(prefix))
+	if len(opts.ClusterNames) > 0 {
+		builder.addExpression(NewTerms(ClusterPath, opts.ClusterNames))
+	}
+	if len(opts.Namespaces) > 0 {
+		builder.addExpression(NewTerms(NameSpacePath, opts.Namespaces))
+	}
+	if len(opts.GroupResources) > 0 {
+		builder.addExpression(newGroupResourcesExpression(opts.GroupResources))
+	}
+	builder.addExpression(newNotDeletedExpression())
+
+	r, err := s.index.Search(ctx, builder.build(), s.resourceIndices())
+	if err != nil {
+		return nil, err
+	}
+	suggestions := make([]*NameSuggestion, 0, len(r.Hits.Hits))
+	for _, hit := range r.Hits.Hits {
+		resource := hit.Source
+		suggestions = append(suggestions, &NameSuggestion{
+			Cluster:   getClusterName(resource.GetObject()),
+			Namespace: resource.GetNamespace(),
+			Name:      resource.GetName(),
+			Group:     resource.GetGroup(),
+			Version:   resource.GetVersion(),
+			Resource:  resource.GetResource(),
+			Kind:      resource.GetKind(),
+			Score:     hit.Score,
+		})
+	}
+	return suggestions, nil
+}
@@ -0,0 +1,126 @@
+package esstorage
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	urlQuerySinceSuffix  = "Since"
+	urlQueryBeforeSuffix = "Before"
+)
+
+// timeRangeFields are the timestamp fields that can be filtered by the `<name>Since` and `<name>Before` url queries,
+// for example `deletionSince=now-1h` or `lastTimestampBefore=2022-11-01T00:00:00Z`
+var timeRangeFields = []struct {
+	name string
+	path string
+}{
+	{"creation", CreationTimestampPath},
+	{"deletion", DeletionTimestampPath},
+	{"lastTimestamp", LastTimestampPath},
+	{"eventTime", EventTimePath},
+	{"startTime", StartTimePath},
+	{"deletedAt", DeletedAtPath},
+}
+
+// dateRangeTimeLayout formats the times in milliseconds, which is the precision of the date fields
+const dateRangeTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// dateMathRegexp matches the relative dates of the Elasticsearch date math, for example `now-1h` or `now-1d/d`
+var dateMathRegexp = regexp.MustCompile(`^now([+-]\d+[yMwdhHms])*(/[yMwdhHms])?$`)
+
+var dateMathOffsetRegexp = regexp.MustCompile(`([+-])(\d+)([yMwdhHms])`)
+
+// newTimeRangeExpressions returns the range queries of the time range url queries
+func newTimeRangeExpressions(urlQuery url.Values) ([]*DateRangeExpression, error) {
+	var expressions []*DateRangeExpression
+	for _, field := range timeRangeFields {
+		since, err := parseTimeRangeValue(urlQuery, field.name+urlQuerySinceSuffix)
+		if err != nil {
+			return nil, err
+		}
+		before, err := parseTimeRangeValue(urlQuery, field.name+urlQueryBeforeSuffix)
+		if err != nil {
+			return nil, err
+		}
+		if since != "" || before != "" {
+			expressions = append(expressions, NewDateRange(field.path, since, before))
+		}
+	}
+	return expressions, nil
+}
+
+// parseTimeRangeValue accepts RFC3339 times and date math relative to now
+func parseTimeRangeValue(urlQuery url.Values, key string) (string, error) {
+	value := urlQuery.Get(key)
+	if value == "" || dateMathRegexp.MatchString(value) {
+		return value, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return "", fmt.Errorf("%s query: %q is neither an RFC3339 time nor a relative time like `now-1h`", key, value)
+	}
+	return t.UTC().Format(dateRangeTimeLayout), nil
+}
+
+// resolveTime resolves an RFC3339 time or a relative time like `now-1h` at now, the dates are rounded in UTC
+func resolveTime(value string, now time.Time) (time.Time, error) {
+	if !dateMathRegexp.MatchString(value) {
+		return time.Parse(time.RFC3339, value)
+	}
+	t := now.UTC()
+	offsets, rounding := strings.TrimPrefix(value, "now"), ""
+	if i := strings.Index(offsets, "/"); i >= 0 {
+		offsets, rounding = offsets[:i], offsets[i+1:]
+	}
+	for _, match := range dateMathOffsetRegexp.FindAllStringSubmatch(offsets, -1) {
+		n, err := strconv.Atoi(match[2])
+		if err != nil {
+			return time.Time{}, err
+		}
+		if match[1] == "-" {
+			n = -n
+		}
+		switch match[3] {
+		case "y":
+			t = t.AddDate(n, 0, 0)
+		case "M":
+			t = t.AddDate(0, n, 0)
+		case "w":
+			t = t.AddDate(0, 0, 7*n)
+		case "d":
+			t = t.AddDate(0, 0, n)
+		case "h", "H":
+			t = t.Add(time.Duration(n) * time.Hour)
+		case "m":
+			t = t.Add(time.Duration(n) * time.Minute)
+		case "s":
+			t = t.Add(time.Duration(n) * time.Second)
+		}
+	}
+
+	year, month, day := t.Date()
+	switch rounding {
+	case "y":
+		t = time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	case "M":
+		t = time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	case "w":
+		weekday := (int(t.Weekday()) + 6) % 7
+		t = time.Date(year, month, day-weekday, 0, 0, 0, 0, time.UTC)
+	case "d":
+		t = time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	case "h", "H":
+		t = t.Truncate(time.Hour)
+	case "m":
+		t = t.Truncate(time.Minute)
+	case "s":
+		t = t.Truncate(time.Second)
+	}
+	return t, nil
+}
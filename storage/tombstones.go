@@ -0,0 +1,129 @@
+package esstorage
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+)
+
+const (
+	DeletedAtPath = "deletedAt"
+
+	// URLQueryIncludeDeleted lists the tombstones with the existing resources,
+	// URLQueryOnlyDeleted lists only the tombstones, they can be combined with `deletedAtSince` and `deletedAtBefore`
+	URLQueryIncludeDeleted = "includeDeleted"
+	URLQueryOnlyDeleted    = "onlyDeleted"
+
+	defaultTombstonesRetention = "7d"
+	tombstonesPurgeInterval    = time.Hour
+)
+
+// TombstonesConfig keeps the deleted objects as tombstones marked with the deletion time,
+// they are hidden from Get and List unless they are asked for
+type TombstonesConfig struct {
+	// Resources are written as `resource.group`, for example `deployments.apps`, `*` keeps the tombstones of every resource
+	Resources []string `yaml:"resources"`
+
+	// Retention is how long the tombstones are kept, in Elasticsearch time units, it defaults to 7d
+	Retention string `yaml:"retention"`
+}
+
+func (c *TombstonesConfig) Enabled(gr schema.GroupResource) bool {
+	set := groupResourceSet(c.Resources)
+	return set.Has(anyResource) || set.Has(gr.String())
+}
+
+func (c *TombstonesConfig) validate() error {
+	if c.Retention == "" {
+		c.Retention = defaultTombstonesRetention
+	}
+	if !dateMathRegexp.MatchString("now-" + c.Retention) {
+		return fmt.Errorf("tombstones: invalid retention %q", c.Retention)
+	}
+	return nil
+}
+
+var tombstoneMapping = map[string]interface{}{
+	DeletedAtPath: map[string]interface{}{"type": "date"},
+}
+
+// newNotDeletedExpression excludes the tombstones
+func newNotDeletedExpression() Expression {
+	tombstones := NewExists(DeletedAtPath)
+	tombstones.SetLogicType(MustNot)
+	return tombstones
+}
+
+// newTombstoneExpression hides the tombstones unless the url query includes them
+func newTombstoneExpression(urlQuery url.Values) (Expression, error) {
+	var includeDeleted, onlyDeleted bool
+	for _, option := range []struct {
+		key   string
+		value *bool
+	}{
+		{URLQueryIncludeDeleted, &includeDeleted},
+		{URLQueryOnlyDeleted, &onlyDeleted},
+	} {
+		if !urlQuery.Has(option.key) {
+			continue
+		}
+		value, err := strconv.ParseBool(urlQuery.Get(option.key))
+		if err != nil {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid %s: %v", option.key, err))
+		}
+		*option.value = value
+	}
+
+	switch {
+	case onlyDeleted:
+		return NewExists(DeletedAtPath), nil
+	case includeDeleted:
+		return nil, nil
+	default:
+		return newNotDeletedExpression(), nil
+	}
+}
+
+// markDeleted turns the document of the object into a tombstone
+func (s *ResourceStorage) markDeleted(ctx context.Context, uid string) error {
+	err := s.index.Update(ctx, s.indexName, uid, map[string]interface{}{
+		DeletedAtPath: time.Now().UTC().Format(time.RFC3339Nano),
+	})
+	if esError, ok := err.(*ESError); ok && esError.StatusCode == 404 {
+		return nil
+	}
+	return err
+}
+
+// addTombstoneIndex records the index of a resource storage which keeps the tombstones
+func (s *StorageFactory) addTombstoneIndex(indexName string) {
+	s.tombstoneLock.Lock()
+	defer s.tombstoneLock.Unlock()
+	s.tombstoneIndices.Insert(indexName)
+}
+
+// purgeTombstones deletes the tombstones older than the retention from the indices which keep them periodically
+func (s *StorageFactory) purgeTombstones() {
+	ticker := time.NewTicker(tombstonesPurgeInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.tombstoneLock.Lock()
+		indices := s.tombstoneIndices.List()
+		s.tombstoneLock.Unlock()
+		if len(indices) == 0 {
+			continue
+		}
+
+		builder := NewQueryBuilder()
+		builder.addExpression(NewDateRange(DeletedAtPath, "", "now-"+s.config.Tombstones.Retention))
+		if err := s.index.DeleteByQuery(context.Background(), builder.build(), indices...); err != nil {
+			klog.ErrorS(err, "Failed to purge the tombstones", "indices", indices, "retention", s.config.Tombstones.Retention)
+		}
+	}
+}
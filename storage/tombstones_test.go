@@ -0,0 +1,74 @@
+package esstorage
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"testing"
+
+	internal "github.com/clusterpedia-io/api/clusterpedia"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestListTombstones(t *testing.T) {
+	s := &ResourceStorage{
+		storageGroupResource: schema.GroupResource{Group: "apps", Resource: "deployments"},
+		storageVersion:       schema.GroupVersion{Group: "apps", Version: "v1"},
+	}
+	deletedAt := map[string]interface{}{"exists": map[string]interface{}{"field": DeletedAtPath}}
+
+	tests := []struct {
+		name        string
+		urlQuery    url.Values
+		wantMust    bool
+		wantMustNot bool
+	}{
+		{name: "tombstones are hidden by default", wantMustNot: true},
+		{name: "includeDeleted returns the tombstones", urlQuery: url.Values{URLQueryIncludeDeleted: {"true"}}},
+		{name: "onlyDeleted returns only the tombstones", urlQuery: url.Values{URLQueryOnlyDeleted: {"true"}}, wantMust: true},
+		{name: "includeDeleted=false hides the tombstones", urlQuery: url.Values{URLQueryIncludeDeleted: {"false"}}, wantMustNot: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &internal.ListOptions{Names: []string{"nginx"}, URLQuery: tt.urlQuery}
+			query, err := s.genListQuery(context.Background(), nil, nil, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var body struct {
+				Query struct {
+					Bool map[string][]interface{} `json:"bool"`
+				} `json:"query"`
+			}
+			data, err := json.Marshal(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(data, &body); err != nil {
+				t.Fatal(err)
+			}
+			boolQuery := body.Query.Bool
+			if got := containsClause(boolQuery["must"], deletedAt); got != tt.wantMust {
+				t.Errorf("must contains the tombstone filter = %v, want %v", got, tt.wantMust)
+			}
+			if got := containsClause(boolQuery["must_not"], deletedAt); got != tt.wantMustNot {
+				t.Errorf("must_not contains the tombstone filter = %v, want %v", got, tt.wantMustNot)
+			}
+		})
+	}
+
+	opts := &internal.ListOptions{URLQuery: url.Values{URLQueryOnlyDeleted: {"yes"}}}
+	if _, err := s.genListQuery(context.Background(), nil, nil, opts); err == nil {
+		t.Error("an invalid onlyDeleted should be rejected")
+	}
+}
+
+func containsClause(clauses []interface{}, clause map[string]interface{}) bool {
+	for _, item := range clauses {
+		if reflect.DeepEqual(item, clause) {
+			return true
+		}
+	}
+	return false
+}
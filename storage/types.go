@@ -1,14 +1,19 @@
 package esstorage
 
 import (
+	"encoding/json"
+	"fmt"
+
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 type SearchResponse struct {
-	ScrollId string `json:"_scroll_id""`
-	Took     int    `json:"took"`
-	TimeOut  bool   `json:"time_out"`
-	Hits     *Hits  `json:"hits"`
+	ScrollId     string                     `json:"_scroll_id"`
+	PitId        string                     `json:"pit_id,omitempty"`
+	Took         int                        `json:"took"`
+	TimeOut      bool                       `json:"time_out"`
+	Hits         *Hits                      `json:"hits"`
+	Aggregations map[string]json.RawMessage `json:"aggregations,omitempty"`
 }
 
 type Hits struct {
@@ -23,20 +28,67 @@ type Total struct {
 }
 
 type Hit struct {
-	Index  string    `json:"_index"`
-	Id     string    `json:"_id"`
-	Score  float32   `json:"_score"`
-	Source *Resource `json:"_source"`
+	Index     string              `json:"_index"`
+	Id        string              `json:"_id"`
+	Score     float32             `json:"_score"`
+	Source    *Resource           `json:"_source"`
+	Highlight map[string][]string `json:"highlight,omitempty"`
+	Sort      []interface{}       `json:"sort,omitempty"`
 }
 
 // TODO total is not exact value. referring: https://www.elastic.co/guide/en/elasticsearch/reference/current/search-your-data.html
+// the total of a collapsed search is the number of the collapsed groups
 func (r *SearchResponse) GetTotal() int64 {
+	if raw, ok := r.Aggregations[collapsedTotalAggregation]; ok {
+		var total struct {
+			Value int64 `json:"value"`
+		}
+		if err := json.Unmarshal(raw, &total); err == nil {
+			return total.Value
+		}
+	}
 	if r.Hits == nil || r.Hits.Total == nil {
 		return 0
 	}
 	return int64(r.Hits.Total.Value)
 }
 
+// GetTermsAggregation decodes the named terms aggregation, it returns nil if the aggregation is absent
+func (r *SearchResponse) GetTermsAggregation(name string) (*TermsAggregation, error) {
+	raw, ok := r.Aggregations[name]
+	if !ok {
+		return nil, nil
+	}
+	var agg TermsAggregation
+	if err := json.Unmarshal(raw, &agg); err != nil {
+		return nil, err
+	}
+	return &agg, nil
+}
+
+// GetCompositeAggregation decodes the named composite aggregation, it returns nil if the aggregation is absent
+func (r *SearchResponse) GetCompositeAggregation(name string) (*CompositeAggregation, error) {
+	raw, ok := r.Aggregations[name]
+	if !ok {
+		return nil, nil
+	}
+	var agg CompositeAggregation
+	if err := json.Unmarshal(raw, &agg); err != nil {
+		return nil, err
+	}
+	return &agg, nil
+}
+
+// GetHighlights returns the highlighted snippets of the field, in the same order as GetResources
+func (r *SearchResponse) GetHighlights(field string) [][]string {
+	hits := r.Hits.Hits
+	highlights := make([][]string, len(hits))
+	for i := range hits {
+		highlights[i] = hits[i].Highlight[field]
+	}
+	return highlights
+}
+
 func (r *SearchResponse) GetResources() []*Resource {
 	hits := r.Hits.Hits
 	resources := make([]*Resource, len(hits))
@@ -46,6 +98,33 @@ func (r *SearchResponse) GetResources() []*Resource {
 	return resources
 }
 
+type TermsAggregation struct {
+	SumOtherDocCount int64     `json:"sum_other_doc_count"`
+	Buckets          []*Bucket `json:"buckets"`
+}
+
+type CompositeAggregation struct {
+	AfterKey map[string]interface{} `json:"after_key,omitempty"`
+	Buckets  []*CompositeBucket     `json:"buckets"`
+}
+
+type CompositeBucket struct {
+	Key      map[string]interface{} `json:"key"`
+	DocCount int64                  `json:"doc_count"`
+}
+
+type Bucket struct {
+	Key      interface{} `json:"key"`
+	DocCount int64       `json:"doc_count"`
+}
+
+func (b *Bucket) KeyString() string {
+	if key, ok := b.Key.(string); ok {
+		return key
+	}
+	return fmt.Sprint(b.Key)
+}
+
 type Resource struct {
 	Group           string                 `json:"group"`
 	Version         string                 `json:"version"`
@@ -55,6 +134,16 @@ type Resource struct {
 	Name            string                 `json:"name"`
 	Namespace       string                 `json:"namespace"`
 	Object          map[string]interface{} `json:"object"`
+	Revision        *Revision              `json:"revision,omitempty"`
+}
+
+// Revision is the metadata of an object revision in the history index
+type Revision struct {
+	Cluster   string `json:"cluster"`
+	Operation string `json:"operation"`
+	Timestamp string `json:"timestamp"`
+	// Until is the time when the revision is superseded by the next revision or the deletion
+	Until string `json:"until,omitempty"`
 }
 
 func (r Resource) GroupVersionResource() schema.GroupVersionResource {
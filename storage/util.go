@@ -2,13 +2,19 @@ package esstorage
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/elastic/go-elasticsearch/v8/esapi"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/util/validation/field"
@@ -20,9 +26,39 @@ import (
 
 const (
 	query = "query"
+
+	// SearchLabelPrefixName matches resources whose name has a word starting with the value,
+	// results are ranked by relevance unless an order is specified
+	SearchLabelPrefixName = "esstorage.clusterpedia.io/prefix-name"
+
+	// SearchLabelContainsName and SearchLabelContainsNamespace match resources
+	// whose name or namespace contains the value
+	SearchLabelContainsName      = "esstorage.clusterpedia.io/contains-name"
+	SearchLabelContainsNamespace = "esstorage.clusterpedia.io/contains-namespace"
+
+	// URLQueryNameWildcard and URLQueryNamespaceWildcard accept wildcard patterns,
+	// `*` matches any sequence of characters and `?` matches any single character
+	URLQueryNameWildcard      = "nameWildcard"
+	URLQueryNamespaceWildcard = "namespaceWildcard"
+
+	// URLQueryHighlight returns the snippets matched by the full text query
+	// in the HighlightAnnotation of each item
+	URLQueryHighlight = "highlight"
+
+	HighlightAnnotation = "esstorage.clusterpedia.io/highlight"
+
+	// sourcesPageSize is the page size of the searches which read all the stored queries
+	sourcesPageSize = 1000
 )
 
-func applyListOptionToQueryBuilder(builder *QueryBuilder, opts *internal.ListOptions) error {
+// applyListOptionToQueryBuilder expands the saved search of the url query before the filters of the request,
+// the expander is nil when the saved searches cannot be referenced
+func applyListOptionToQueryBuilder(ctx context.Context, expander *savedSearchExpander, builder *QueryBuilder, opts *internal.ListOptions) error {
+	savedSort, err := applySavedSearch(ctx, expander, builder, opts)
+	if err != nil {
+		return err
+	}
+
 	if opts.ClusterNames != nil {
 		queryItem := NewTerms(ClusterPath, opts.ClusterNames)
 		builder.addExpression(queryItem)
@@ -42,6 +78,14 @@ func applyListOptionToQueryBuilder(builder *QueryBuilder, opts *internal.ListOpt
 		builder.addExpression(queryItem)
 	}
 
+	tombstones, err := newTombstoneExpression(opts.URLQuery)
+	if err != nil {
+		return err
+	}
+	if tombstones != nil {
+		builder.addExpression(tombstones)
+	}
+
 	if opts.LabelSelector != nil {
 		if requirements, selectable := opts.LabelSelector.Requirements(); selectable {
 			for _, requirement := range requirements {
@@ -69,11 +113,30 @@ func applyListOptionToQueryBuilder(builder *QueryBuilder, opts *internal.ListOpt
 						queryItem := NewFuzzy("name", values)
 						builder.addExpression(queryItem)
 					}
+				case SearchLabelPrefixName:
+					for _, name := range requirement.Values().List() {
+						builder.addExpression(newNamePrefixExpression(strings.TrimSpace(name)))
+					}
+				case SearchLabelContainsName:
+					for _, name := range requirement.Values().List() {
+						builder.addExpression(NewWildcard(NameWildcardPath, "*"+escapeWildcard(strings.TrimSpace(name))+"*"))
+					}
+				case SearchLabelContainsNamespace:
+					for _, namespace := range requirement.Values().List() {
+						builder.addExpression(NewWildcard(NamespaceWildcardPath, "*"+escapeWildcard(strings.TrimSpace(namespace))+"*"))
+					}
 				}
 			}
 		}
 	}
 
+	for _, pattern := range opts.URLQuery[URLQueryNameWildcard] {
+		builder.addExpression(NewWildcard(NameWildcardPath, pattern))
+	}
+	for _, pattern := range opts.URLQuery[URLQueryNamespaceWildcard] {
+		builder.addExpression(NewWildcard(NamespaceWildcardPath, pattern))
+	}
+
 	if len(opts.URLQuery[query]) > 0 {
 		query := opts.URLQuery[query][0]
 		simpleQueryStringExpression := &SimpleQueryStringExpression{
@@ -81,6 +144,33 @@ func applyListOptionToQueryBuilder(builder *QueryBuilder, opts *internal.ListOpt
 			Fields: []string{FullTextObjectPath},
 		}
 		builder.addExpression(simpleQueryStringExpression)
+
+		if highlight, _ := strconv.ParseBool(opts.URLQuery.Get(URLQueryHighlight)); highlight {
+			builder.highlight = map[string]interface{}{
+				"fields": map[string]interface{}{
+					FullTextObjectPath: map[string]interface{}{
+						"fragment_size":       150,
+						"number_of_fragments": 3,
+					},
+				},
+			}
+		}
+	}
+
+	timeRangeItems, err := newTimeRangeExpressions(opts.URLQuery)
+	if err != nil {
+		return apierrors.NewBadRequest(err.Error())
+	}
+	for _, queryItem := range timeRangeItems {
+		builder.addExpression(queryItem)
+	}
+
+	conditionItem, err := newConditionExpression(opts.URLQuery)
+	if err != nil {
+		return apierrors.NewBadRequest(err.Error())
+	}
+	if conditionItem != nil {
+		builder.addExpression(conditionItem)
 	}
 
 	if opts.EnhancedFieldSelector != nil {
@@ -100,9 +190,12 @@ func applyListOptionToQueryBuilder(builder *QueryBuilder, opts *internal.ListOpt
 				if len(fieldErrors) != 0 {
 					return apierrors.NewInvalid(schema.GroupKind{Group: internal.GroupName, Kind: "ListOptions"}, "fieldSelector", fieldErrors)
 				}
-				fields = append(fields, "")
-				copy(fields[1:], fields[0:])
-				fields[0] = "object"
+				// the extracted fields are stored beside the object
+				if fields[0] != ExtractedPath {
+					fields = append(fields, "")
+					copy(fields[1:], fields[0:])
+					fields[0] = "object"
+				}
 				path := strings.Join(fields, ".")
 				values := requirement.Values().List()
 				switch requirement.Operator() {
@@ -113,6 +206,10 @@ func applyListOptionToQueryBuilder(builder *QueryBuilder, opts *internal.ListOpt
 					queryItem := NewTerms(path, values)
 					queryItem.SetLogicType(MustNot)
 					builder.addExpression(queryItem)
+				case selection.GreaterThan:
+					builder.addExpression(NewCompare(path, "gt", values[0]))
+				case selection.LessThan:
+					builder.addExpression(NewCompare(path, "lt", values[0]))
 				}
 			}
 		}
@@ -124,8 +221,12 @@ func applyListOptionToQueryBuilder(builder *QueryBuilder, opts *internal.ListOpt
 	}
 	offset, _ := strconv.Atoi(opts.Continue)
 
+	orderBy := opts.OrderBy
+	if len(orderBy) == 0 {
+		orderBy = savedSort
+	}
 	var sort []map[string]interface{}
-	for _, orderby := range opts.OrderBy {
+	for _, orderby := range orderBy {
 		queryItem := sortQuery(orderby.Field, orderby.Desc)
 		sort = append(sort, queryItem)
 	}
@@ -135,17 +236,61 @@ func applyListOptionToQueryBuilder(builder *QueryBuilder, opts *internal.ListOpt
 	return nil
 }
 
-func (s *ResourceStorage) genListQuery(ownerIds []string, opts *internal.ListOptions) (map[string]interface{}, error) {
+func (s *ResourceStorage) genListQuery(ctx context.Context, ownerIds []string, drift *DriftReport, opts *internal.ListOptions) (map[string]interface{}, error) {
+	if err := s.validateFieldSelector(opts); err != nil {
+		return nil, err
+	}
 	builder := NewQueryBuilder()
 
-	err := applyListOptionToQueryBuilder(builder, opts)
+	err := applyListOptionToQueryBuilder(ctx, s.savedSearchExpander(), builder, opts)
 	if err != nil {
 		return nil, err
 	}
 
+	orphans, err := s.newOrphanExpression(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if orphans != nil {
+		builder.addExpression(orphans)
+	}
+
+	asOf, changedSince, changedBefore, err := parseHistoryQuery(opts.URLQuery)
+	if err != nil {
+		return nil, err
+	}
+	diffRange, err := parseDiffQuery(opts.URLQuery)
+	if err != nil {
+		return nil, err
+	}
+	if diffRange != nil && asOf == "" {
+		asOf = diffRange.asOf()
+	}
+	if asOf != "" {
+		for _, expression := range newAsOfExpressions(asOf) {
+			builder.addExpression(expression)
+		}
+	}
+	applyChangedQuery(builder, changedSince, changedBefore)
+
+	if drift != nil {
+		builder.addExpression(newDriftExpression(drift))
+	}
+
+	likeObject, err := s.newLikeObjectExpressions(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, expression := range likeObject {
+		builder.addExpression(expression)
+	}
+
 	if len(opts.ClusterNames) == 1 && (len(opts.OwnerUID) != 0 || len(opts.OwnerName) != 0) {
-		queryItem := NewTerms(OwnerReferencePath, ownerIds)
-		builder.addExpression(queryItem)
+		builder.addExpression(s.ownerIdsExpression(ownerIds))
+		// the events of the owner and its descendants are returned from the latest one
+		if isEventResource(s.storageGroupResource) && len(builder.sort) == 0 {
+			builder.sort = []map[string]interface{}{{LastTimestampPath: map[string]interface{}{"order": "desc", "missing": "_last"}}}
+		}
 	}
 
 	groupItem := NewTerms(GroupPath, []string{s.storageVersion.Group})
@@ -154,9 +299,13 @@ func (s *ResourceStorage) genListQuery(ownerIds []string, opts *internal.ListOpt
 	builder.addExpression(versionItem)
 	resourceItem := NewTerms(ResourcePath, []string{s.storageGroupResource.Resource})
 	builder.addExpression(resourceItem)
+	if isEventResource(s.storageGroupResource) {
+		s.applyEventQuery(builder, opts.URLQuery)
+	}
 	return builder.build(), nil
 }
 
+// ensureIndex creates the index, or adds the new fields of the mapping to the existing index
 func ensureIndex(client *elasticsearch.Client, mapping string, indexName string) error {
 	req := esapi.IndicesCreateRequest{
 		Index: indexName,
@@ -171,13 +320,93 @@ func ensureIndex(client *elasticsearch.Client, mapping string, indexName string)
 		msg := resp.String()
 		if strings.Contains(resp.String(), "resource_already_exists_exception") {
 			klog.Warningf("index %s already exists", indexName)
-			return nil
+			return updateIndexMapping(client, mapping, indexName)
 		}
 		return fmt.Errorf(msg)
 	}
 	return nil
 }
 
+// updateIndexMapping puts the properties of the mapping to the existing index, the fields
+// whose mapping is changed incompatibly are kept as they are until the index is recreated
+func updateIndexMapping(client *elasticsearch.Client, mapping string, indexName string) error {
+	var template map[string]interface{}
+	if err := json.Unmarshal([]byte(mapping), &template); err != nil {
+		return err
+	}
+	properties, ok := simpleMapExtract("mappings.properties", template).(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return putProperties(context.Background(), NewIndex(client), indexName, nil, properties)
+}
+
+// putProperties puts the properties under the parent path, if they are rejected the fields are put one by one,
+// so that a conflicting field does not prevent the other fields from being added
+func putProperties(ctx context.Context, index *Index, indexName string, parent []string, properties map[string]interface{}) error {
+	wrapped := properties
+	for i := len(parent) - 1; i >= 0; i-- {
+		wrapped = map[string]interface{}{parent[i]: map[string]interface{}{"properties": wrapped}}
+	}
+	err := index.PutMapping(ctx, indexName, wrapped)
+	esError, ok := err.(*ESError)
+	if !ok || esError.StatusCode != http.StatusBadRequest {
+		return err
+	}
+	if len(properties) == 1 {
+		for field, fieldMapping := range properties {
+			children, ok := fieldMapping.(map[string]interface{})["properties"].(map[string]interface{})
+			if !ok || len(children) == 0 {
+				klog.Warningf("the mapping of %s in index %s is not updated, recreate the index to apply it: %s",
+					strings.Join(append(parent, field), "."), indexName, esError.Message)
+				return nil
+			}
+			return putProperties(ctx, index, indexName, append(parent, field), children)
+		}
+	}
+	for field, fieldMapping := range properties {
+		if err := putProperties(ctx, index, indexName, parent, map[string]interface{}{field: fieldMapping}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateFieldSelector rejects the field selectors of the object fields which are stored but not indexed,
+// because they would match nothing
+func (s *ResourceStorage) validateFieldSelector(opts *internal.ListOptions) error {
+	if s.indexedFields == nil || opts.EnhancedFieldSelector == nil {
+		return nil
+	}
+	requirements, _ := opts.EnhancedFieldSelector.Requirements()
+	for _, requirement := range requirements {
+		fields := requirement.Fields()
+		if len(fields) == 0 || fields[0].Name() == ExtractedPath || s.indexedFields.Has(fields[0].Name()) {
+			continue
+		}
+		return apierrors.NewBadRequest(fmt.Sprintf("field selector %s: the field %s of %s is not indexed", requirement.String(), fields[0].Name(), s.storageGroupResource))
+	}
+	return nil
+}
+
+// searchAllSources pages through the sources matched by the builder in the order of a unique keyword field
+func searchAllSources(ctx context.Context, index *Index, builder *QueryBuilder, keyField string, indexNames []string) ([]map[string]interface{}, error) {
+	builder.size = sourcesPageSize
+	builder.sort = []map[string]interface{}{{keyField: map[string]interface{}{"order": "asc"}}}
+	var result []map[string]interface{}
+	for {
+		sources, err := index.SearchSources(ctx, builder.build(), indexNames)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, sources...)
+		if len(sources) < sourcesPageSize {
+			return result, nil
+		}
+		builder.searchAfter = []interface{}{simpleMapExtract(keyField, sources[len(sources)-1])}
+	}
+}
+
 func simpleMapExtract(path string, object map[string]interface{}) interface{} {
 	fields := strings.Split(path, ".")
 	var cur interface{}
@@ -193,12 +422,74 @@ func simpleMapExtract(path string, object map[string]interface{}) interface{} {
 	return cur
 }
 
+var wildcardEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`)
+
+// escapeWildcard escapes the characters of the value which are special in wildcard patterns
+func escapeWildcard(value string) string {
+	return wildcardEscaper.Replace(value)
+}
+
+func newNamePrefixExpression(prefix string) *MultiMatchExpression {
+	return NewMultiMatch(prefix, "bool_prefix", NameSuggestPath, NameSuggestPath+"._2gram", NameSuggestPath+"._3gram")
+}
+
+// toUnstructuredObject converts the object to a map that can be modified without affecting the object
+func toUnstructuredObject(obj runtime.Object) (map[string]interface{}, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return runtime.DeepCopyJSON(u.Object), nil
+	}
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+}
+
+// getClusterName returns the cluster name recorded in the shadow annotation of the object
+func getClusterName(object map[string]interface{}) string {
+	annotations, ok := simpleMapExtract("metadata.annotations", object).(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	cluster, _ := annotations[ClusterAnnotation].(string)
+	return cluster
+}
+
+// setHighlightAnnotation records the highlighted snippets in the annotations of the object
+func setHighlightAnnotation(obj runtime.Object, snippets []string) error {
+	if len(snippets) == 0 {
+		return nil
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(snippets)
+	if err != nil {
+		return err
+	}
+	annotations := accessor.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[HighlightAnnotation] = string(value)
+	accessor.SetAnnotations(annotations)
+	return nil
+}
+
+func mapKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func sortQuery(path string, desc bool) map[string]interface{} {
 	sort := map[string]interface{}{}
 	if !strings.Contains(path, SpecPath) {
 		switch path {
 		case "created_at":
 			path = strings.Join([]string{CreationTimestampPath, KeywordPath}, ".")
+		case "score":
+			path = "_score"
 		default:
 			path = strings.Join([]string{path, KeywordPath}, ".")
 		}
@@ -0,0 +1,114 @@
+package esstorage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	defaultVocabularyKeySize   = 100
+	defaultVocabularyValueSize = 10
+
+	vocabularyKeysAggregation = "keys"
+)
+
+// VocabularyOptions scopes a label or annotation vocabulary query
+type VocabularyOptions struct {
+	ClusterNames   []string
+	Namespaces     []string
+	GroupResources []schema.GroupResource
+
+	// KeySize is the max number of keys returned, ordered by document count
+	KeySize int
+	// ValueSize is the max number of values returned per key, ordered by document count
+	ValueSize int
+}
+
+type Vocabulary struct {
+	Keys []*VocabularyKey `json:"keys"`
+}
+
+type VocabularyKey struct {
+	Key    string             `json:"key"`
+	Count  int64              `json:"count"`
+	Values []*VocabularyValue `json:"values,omitempty"`
+}
+
+type VocabularyValue struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// GetLabelVocabulary returns the distinct label keys and the top values per key
+func (s *StorageFactory) GetLabelVocabulary(ctx context.Context, opts *VocabularyOptions) (*Vocabulary, error) {
+	return s.getVocabulary(ctx, LabelKeysPath, LabelPath, opts)
+}
+
+// GetAnnotationVocabulary returns the distinct annotation keys and the top values per key
+func (s *StorageFactory) GetAnnotationVocabulary(ctx context.Context, opts *VocabularyOptions) (*Vocabulary, error) {
+	return s.getVocabulary(ctx, AnnotationKeysPath, AnnotationPath, opts)
+}
+
+// getVocabulary aggregates the keys recorded in keysPath first, then aggregates
+// the values of the top keys on the keyed subfields of the flattened valuesPath
+func (s *StorageFactory) getVocabulary(ctx context.Context, keysPath, valuesPath string, opts *VocabularyOptions) (*Vocabulary, error) {
+	keySize, valueSize := opts.KeySize, opts.ValueSize
+	if keySize <= 0 {
+		keySize = defaultVocabularyKeySize
+	}
+	if valueSize <= 0 {
+		valueSize = defaultVocabularyValueSize
+	}
+
+	scope := &AggregationScope{
+		ClusterNames:   opts.ClusterNames,
+		Namespaces:     opts.Namespaces,
+		GroupResources: opts.GroupResources,
+	}
+	builder := scope.newQueryBuilder()
+	builder.addAggregation(vocabularyKeysAggregation, newTermsAggregation(keysPath, keySize))
+	r, err := s.index.Search(ctx, builder.build(), s.resourceIndices())
+	if err != nil {
+		return nil, err
+	}
+	keysAgg, err := r.GetTermsAggregation(vocabularyKeysAggregation)
+	if err != nil {
+		return nil, err
+	}
+
+	vocabulary := &Vocabulary{}
+	if keysAgg == nil || len(keysAgg.Buckets) == 0 {
+		return vocabulary, nil
+	}
+
+	builder = scope.newQueryBuilder()
+	for i, bucket := range keysAgg.Buckets {
+		key := bucket.KeyString()
+		vocabulary.Keys = append(vocabulary.Keys, &VocabularyKey{Key: key, Count: bucket.DocCount})
+		builder.addAggregation(valueAggregationName(i), newTermsAggregation(strings.Join([]string{valuesPath, key}, "."), valueSize))
+	}
+	r, err = s.index.Search(ctx, builder.build(), s.resourceIndices())
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range vocabulary.Keys {
+		valuesAgg, err := r.GetTermsAggregation(valueAggregationName(i))
+		if err != nil {
+			return nil, err
+		}
+		if valuesAgg == nil {
+			continue
+		}
+		for _, bucket := range valuesAgg.Buckets {
+			key.Values = append(key.Values, &VocabularyValue{Value: bucket.KeyString(), Count: bucket.DocCount})
+		}
+	}
+	return vocabulary, nil
+}
+
+func valueAggregationName(i int) string {
+	return fmt.Sprintf("values-%d", i)
+}